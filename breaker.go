@@ -0,0 +1,304 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// Default config of the circuit breaker
+	defaultBreakerFailures    = 5
+	defaultBreakerMinRequests = 20
+	defaultBreakerWindow      = time.Minute
+	defaultBreakerOpenTimeout = 30 * time.Second
+	defaultBreakerProbes      = 1
+)
+
+var (
+	// Errors
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+)
+
+// BreakerState state of a CircuitBreaker
+type BreakerState int
+
+// States
+const (
+	// BreakerClosed requests are executed
+	BreakerClosed BreakerState = iota
+	// BreakerOpen requests fail fast
+	BreakerOpen
+	// BreakerHalfOpen a limited number of requests probe if FCM recovered
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// BreakerConfig config of a CircuitBreaker, the zero values use the defaults
+type BreakerConfig struct {
+	// ConsecutiveFailures open the circuit after this number of failures in a row, 5 by default
+	ConsecutiveFailures int
+	// FailureRate open the circuit when the rate of failures in Window reach it, 0 disable it
+	FailureRate float64
+	// MinRequests min number of requests in Window to apply FailureRate, 20 by default
+	MinRequests int
+	// Window period of the failure rate, 1m by default
+	Window time.Duration
+	// OpenTimeout time the circuit stays open before probe, 30s by default
+	OpenTimeout time.Duration
+	// HalfOpenProbes requests permitted in half-open state, the circuit closes when all succeed, 1 by default
+	HalfOpenProbes int
+	// IsFailure return true if err must count as a failure, by default network errors, 429 and 5xx
+	IsFailure func(err error) bool
+	// OnStateChange is called when the state changes, it must not call the breaker
+	OnStateChange func(from, to BreakerState)
+}
+
+// BreakerStats snapshot of a CircuitBreaker for health checks and metrics
+type BreakerStats struct {
+	State               BreakerState
+	ConsecutiveFailures int
+	// Requests and Failures of the current window
+	Requests int
+	Failures int
+	// OpenedAt time the circuit opened, zero if it is closed
+	OpenedAt time.Time
+}
+
+// BreakerOpenError error returned without execute the request while the circuit is open
+type BreakerOpenError struct {
+	State BreakerState
+	// RetryAt time the circuit will permit probes, zero in half-open state where it
+	// depends on the result of the probes in flight
+	RetryAt time.Time
+}
+
+func (e *BreakerOpenError) Error() string {
+	if e.RetryAt.IsZero() {
+		return fmt.Sprintf("%v, waiting for the %s probes", ErrCircuitOpen, e.State)
+	}
+
+	return fmt.Sprintf("%v, retry at %s", ErrCircuitOpen, e.RetryAt.Format(time.RFC3339))
+}
+
+func (e *BreakerOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// CircuitBreaker fail fast the operations while FCM is failing, it is added to a client
+// with Use(b.Middleware()) and can be shared by several clients
+type CircuitBreaker struct {
+	cfg BreakerConfig
+
+	mu                  sync.Mutex
+	state               BreakerState
+	generation          uint64
+	consecutiveFailures int
+	requests            int
+	failures            int
+	windowStart         time.Time
+	openedAt            time.Time
+	probes              int
+	probeSuccesses      int
+
+	// now is replaced by tests
+	now func() time.Time
+}
+
+// NewCircuitBreaker create a closed circuit breaker
+func NewCircuitBreaker(cfg BreakerConfig) *CircuitBreaker {
+	if cfg.ConsecutiveFailures <= 0 {
+		cfg.ConsecutiveFailures = defaultBreakerFailures
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = defaultBreakerMinRequests
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = defaultBreakerWindow
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = defaultBreakerOpenTimeout
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = defaultBreakerProbes
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = isBreakerFailure
+	}
+
+	return &CircuitBreaker{cfg: cfg, now: time.Now}
+}
+
+// State return the current state
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(b.now())
+	return b.state
+}
+
+// Stats return a snapshot of the breaker
+func (b *CircuitBreaker) Stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(b.now())
+	return BreakerStats{
+		State:               b.state,
+		ConsecutiveFailures: b.consecutiveFailures,
+		Requests:            b.requests,
+		Failures:            b.failures,
+		OpenedAt:            b.openedAt,
+	}
+}
+
+// Middleware return the middleware that execute the operations through the breaker
+func (b *CircuitBreaker) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return func(op *Operation) error {
+			generation, err := b.allow()
+			if err != nil {
+				return err
+			}
+
+			err = next(op)
+			b.record(generation, err)
+
+			return err
+		}
+	}
+}
+
+// allow return the generation of the state if the request can be executed
+func (b *CircuitBreaker) allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.advance(now)
+
+	switch b.state {
+	case BreakerOpen:
+		return 0, &BreakerOpenError{State: b.state, RetryAt: b.openedAt.Add(b.cfg.OpenTimeout)}
+	case BreakerHalfOpen:
+		if b.probes >= b.cfg.HalfOpenProbes {
+			return 0, &BreakerOpenError{State: b.state}
+		}
+		b.probes++
+	}
+
+	return b.generation, nil
+}
+
+// record count the result of a request executed in generation
+func (b *CircuitBreaker) record(generation uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.advance(now)
+
+	// The state changed while the request was executed
+	if generation != b.generation {
+		return
+	}
+
+	failed := err != nil && b.cfg.IsFailure(err)
+
+	if b.state == BreakerHalfOpen {
+		if failed {
+			b.setState(BreakerOpen, now)
+			return
+		}
+
+		b.probeSuccesses++
+		if b.probeSuccesses >= b.cfg.HalfOpenProbes {
+			b.setState(BreakerClosed, now)
+		}
+		return
+	}
+
+	b.requests++
+	if !failed {
+		b.consecutiveFailures = 0
+		return
+	}
+
+	b.failures++
+	b.consecutiveFailures++
+
+	rate := float64(b.failures) / float64(b.requests)
+	if b.consecutiveFailures >= b.cfg.ConsecutiveFailures ||
+		(b.cfg.FailureRate > 0 && b.requests >= b.cfg.MinRequests && rate >= b.cfg.FailureRate) {
+		b.setState(BreakerOpen, now)
+	}
+}
+
+// advance move from open to half-open after OpenTimeout and reset the window when it ends
+func (b *CircuitBreaker) advance(now time.Time) {
+	switch b.state {
+	case BreakerOpen:
+		if !now.Before(b.openedAt.Add(b.cfg.OpenTimeout)) {
+			b.setState(BreakerHalfOpen, now)
+		}
+	case BreakerClosed:
+		if now.Sub(b.windowStart) >= b.cfg.Window {
+			b.windowStart = now
+			b.requests, b.failures = 0, 0
+		}
+	}
+}
+
+// setState change the state and reset the counters
+func (b *CircuitBreaker) setState(state BreakerState, now time.Time) {
+	from := b.state
+
+	b.state = state
+	b.generation++
+	b.consecutiveFailures = 0
+	b.requests, b.failures = 0, 0
+	b.windowStart = now
+	b.probes, b.probeSuccesses = 0, 0
+
+	switch state {
+	case BreakerOpen:
+		b.openedAt = now
+	case BreakerClosed:
+		b.openedAt = time.Time{}
+	}
+
+	if b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(from, state)
+	}
+}
+
+// isBreakerFailure return true for network errors, 429 and 5xx, the errors about the request
+// or the tokens and the canceled operations are not failures of FCM
+func isBreakerFailure(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Temporary()
+	}
+
+	var tokenErr *TokenError
+	if errors.As(err, &tokenErr) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,214 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestBreaker(cfg BreakerConfig) (*CircuitBreaker, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1500000000, 0)}
+	b := NewCircuitBreaker(cfg)
+	b.now = clock.Now
+
+	return b, clock
+}
+
+func TestCircuitBreaker_ConsecutiveFailures(t *testing.T) {
+	t.Parallel()
+
+	var changes []string
+	b, clock := newTestBreaker(BreakerConfig{
+		ConsecutiveFailures: 3,
+		OpenTimeout:         10 * time.Second,
+		OnStateChange: func(from, to BreakerState) {
+			changes = append(changes, fmt.Sprintf("%v->%v", from, to))
+		},
+	})
+
+	var calls int
+	failing := errors.New("connection refused")
+	h := b.Middleware()(func(op *Operation) error {
+		calls++
+		return failing
+	})
+
+	for i := 0; i < 3; i++ {
+		if err := h(&Operation{}); err != failing {
+			t.Fatalf("expected failing, got %v", err)
+		}
+	}
+
+	if b.State() != BreakerOpen {
+		t.Fatalf("expected open, got %v", b.State())
+	}
+
+	err := h(&Operation{})
+	var openErr *BreakerOpenError
+	if !errors.As(err, &openErr) || !errors.Is(err, ErrCircuitOpen) || calls != 3 {
+		t.Fatalf("expected fail fast, got %v after %d calls", err, calls)
+	}
+
+	if !openErr.RetryAt.Equal(clock.now.Add(10 * time.Second)) {
+		t.Errorf("unexpected retry at %v", openErr.RetryAt)
+	}
+
+	// A failed probe open the circuit again
+	clock.now = clock.now.Add(10 * time.Second)
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("expected half-open, got %v", b.State())
+	}
+	h(&Operation{})
+	if b.State() != BreakerOpen {
+		t.Fatalf("expected open, got %v", b.State())
+	}
+
+	// A successful probe close it
+	clock.now = clock.now.Add(10 * time.Second)
+	failing = nil
+	if err := h(&Operation{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.State() != BreakerClosed {
+		t.Fatalf("expected closed, got %v", b.State())
+	}
+
+	expected := "[closed->open open->half-open half-open->open open->half-open half-open->closed]"
+	if fmt.Sprint(changes) != expected {
+		t.Errorf("expected %s, got %v", expected, changes)
+	}
+}
+
+func TestCircuitBreaker_HalfOpenProbes(t *testing.T) {
+	t.Parallel()
+
+	b, clock := newTestBreaker(BreakerConfig{ConsecutiveFailures: 1, OpenTimeout: 10 * time.Second})
+	b.Middleware()(func(op *Operation) error { return errors.New("connection refused") })(&Operation{})
+
+	clock.now = clock.now.Add(10 * time.Second)
+
+	var probeErr error
+	h := b.Middleware()(func(op *Operation) error {
+		// The probe is in flight
+		_, probeErr = b.allow()
+		return nil
+	})
+	if err := h(&Operation{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var openErr *BreakerOpenError
+	if !errors.As(probeErr, &openErr) || openErr.State != BreakerHalfOpen || !openErr.RetryAt.IsZero() {
+		t.Errorf("expected half-open rejection without retry time, got %v", probeErr)
+	}
+
+	if b.State() != BreakerClosed {
+		t.Errorf("expected closed, got %v", b.State())
+	}
+}
+
+func TestCircuitBreaker_FailureRate(t *testing.T) {
+	t.Parallel()
+
+	b, clock := newTestBreaker(BreakerConfig{ConsecutiveFailures: 100, FailureRate: 0.4, MinRequests: 4})
+
+	results := []error{nil, &HTTPError{StatusCode: http.StatusServiceUnavailable}, nil}
+	for _, r := range results {
+		r := r
+		b.Middleware()(func(op *Operation) error { return r })(&Operation{})
+	}
+
+	if stats := b.Stats(); stats.State != BreakerClosed || stats.Requests != 3 || stats.Failures != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// Errors of the request are not failures of FCM
+	b.Middleware()(func(op *Operation) error {
+		return &HTTPError{StatusCode: http.StatusBadRequest}
+	})(&Operation{})
+	if b.State() != BreakerClosed {
+		t.Fatalf("expected closed, got %v", b.State())
+	}
+
+	b.Middleware()(func(op *Operation) error {
+		return &HTTPError{StatusCode: http.StatusInternalServerError}
+	})(&Operation{})
+	if stats := b.Stats(); stats.State != BreakerOpen || !stats.OpenedAt.Equal(clock.now) {
+		t.Fatalf("expected open, got %+v", stats)
+	}
+}
+
+func TestCircuitBreaker_Window(t *testing.T) {
+	t.Parallel()
+
+	b, clock := newTestBreaker(BreakerConfig{ConsecutiveFailures: 100, FailureRate: 0.5, MinRequests: 2, Window: time.Minute})
+
+	b.Middleware()(func(op *Operation) error { return errors.New("timeout") })(&Operation{})
+	clock.now = clock.now.Add(time.Minute)
+
+	if stats := b.Stats(); stats.Requests != 0 || stats.Failures != 0 {
+		t.Errorf("expected new window, got %+v", stats)
+	}
+}
+
+func TestClient_CircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		rw.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	b := NewCircuitBreaker(BreakerConfig{ConsecutiveFailures: 2})
+	client := NewClient("key", WithEndpoints(Endpoints{FCM: server.URL}), WithCircuitBreaker(b))
+	client.PushSingle("token", map[string]string{"msg": "hi"})
+
+	for i := 0; i < 4; i++ {
+		client.SendContext(context.Background())
+	}
+
+	if _, err := client.Send(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+}
+
+func TestIsBreakerFailure(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		err     error
+		failure bool
+	}{
+		{errors.New("dial tcp: i/o timeout"), true},
+		{&HTTPError{StatusCode: http.StatusTooManyRequests}, true},
+		{&HTTPError{StatusCode: http.StatusNotFound}, false},
+		{&TokenError{StatusCode: http.StatusBadRequest, Reason: "InvalidToken"}, false},
+		{fmt.Errorf("send: %w", context.Canceled), false},
+	}
+
+	for _, c := range cases {
+		if isBreakerFailure(c.err) != c.failure {
+			t.Errorf("%v: expected %v", c.err, c.failure)
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package fcm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Default number of batches sent at the same time by a campaign
+	defaultCampaignConcurrency = 4
+)
+
+var (
+	// Errors
+	ErrNoTokenIterator = errors.New("token iterator is not set")
+	ErrNoCampaignID    = errors.New("campaign id is required to save checkpoints")
+)
+
+// TokenIterator provide the tokens of a campaign. Next must return the same tokens for the
+// same cursor so a campaign can be resumed from a checkpoint
+type TokenIterator interface {
+	// Next return up to n tokens after cursor and the cursor of the last one, no tokens
+	// means the end. The cursor of the start is empty
+	Next(ctx context.Context, cursor string, n int) (tokens []string, next string, err error)
+}
+
+// SliceTokens TokenIterator of a slice, the cursor is the index of the next token
+type SliceTokens []string
+
+// Next return the tokens after the index cursor
+func (s SliceTokens) Next(ctx context.Context, cursor string, n int) ([]string, string, error) {
+	start := 0
+	if cursor != "" {
+		i, err := strconv.Atoi(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		start = i
+	}
+
+	if start >= len(s) {
+		return nil, cursor, nil
+	}
+
+	end := start + n
+	if end > len(s) {
+		end = len(s)
+	}
+
+	return s[start:end], strconv.Itoa(end), nil
+}
+
+// Checkpoint progress of a campaign saved to resume it
+type Checkpoint struct {
+	// Cursor of the first batch not completed, the batches before are completed
+	Cursor string `json:"cursor"`
+	// Batch number of the batch at Cursor
+	Batch int64 `json:"batch"`
+	// Done numbers of the batches after Batch already completed
+	Done []int64 `json:"done,omitempty"`
+	// Sent and Failed tokens of the completed batches
+	Sent   int `json:"sent"`
+	Failed int `json:"failed"`
+	// Finished is true when all the batches are completed
+	Finished bool `json:"finished"`
+}
+
+// CheckpointStore save the checkpoints of the campaigns
+type CheckpointStore interface {
+	// Load return the checkpoint of the campaign, nil if there is no one
+	Load(ctx context.Context, campaignID string) (*Checkpoint, error)
+	// Save replace the checkpoint of the campaign
+	Save(ctx context.Context, campaignID string, cp *Checkpoint) error
+}
+
+// FileCheckpointStore CheckpointStore that save the checkpoints as JSON files in a directory
+type FileCheckpointStore string
+
+// Load read the checkpoint of the campaign
+func (dir FileCheckpointStore) Load(ctx context.Context, campaignID string) (*Checkpoint, error) {
+	b, err := os.ReadFile(dir.path(campaignID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cp := new(Checkpoint)
+	if err := json.Unmarshal(b, cp); err != nil {
+		return nil, err
+	}
+
+	return cp, nil
+}
+
+// Save write the checkpoint of the campaign atomically
+func (dir FileCheckpointStore) Save(ctx context.Context, campaignID string, cp *Checkpoint) error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	path := dir.path(campaignID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func (dir FileCheckpointStore) path(campaignID string) string {
+	return filepath.Join(string(dir), campaignID+".json")
+}
+
+// CampaignProgress progress of a campaign
+type CampaignProgress struct {
+	// Sent and Failed tokens, including the ones of the runs resumed
+	Sent   int
+	Failed int
+	// Remaining tokens, -1 if Total of the campaign is unknown
+	Remaining int
+	// Elapsed time of this run
+	Elapsed time.Duration
+	// ETA estimated time to finish from the rate of this run, zero if unknown
+	ETA time.Duration
+}
+
+// Campaign config of a broadcast of the message of the client
+type Campaign struct {
+	// ID of the campaign, required to save checkpoints
+	ID string
+	// Tokens of the campaign
+	Tokens TokenIterator
+	// Total number of tokens if known, used to estimate Remaining and ETA
+	Total int
+	// Concurrency max number of batches sent at the same time, 4 by default
+	Concurrency int
+	// RateLimit max number of batches sent per second, 0 is unlimited
+	RateLimit float64
+	// Checkpoints store to save the progress and resume the campaign, optional
+	Checkpoints CheckpointStore
+	// CheckpointEvery min time between checkpoints, 0 save a checkpoint after every batch
+	CheckpointEvery time.Duration
+	// OnProgress is called after every batch
+	OnProgress func(p CampaignProgress)
+	// OnBatch is called with the result of every batch sent, e.g. to remove the invalid tokens
+	OnBatch func(tokens []string, resp *Response, err error)
+}
+
+// RunCampaign send the data and notification of the message to the tokens of the campaign in batches
+// of 1000 ids. With a CheckpointStore the campaign resumes from its last checkpoint without send again
+// the batches completed. Only the tokens rejected in the results of FCM count as failed, a batch that
+// can't be sent (e.g. open circuit, rejected credential, 429, 5xx or network error) stops the run
+// without completing the batch so it is sent again when the campaign resumes
+func (c *Client) RunCampaign(ctx context.Context, campaign Campaign) (*CampaignProgress, error) {
+	if campaign.Tokens == nil {
+		return nil, ErrNoTokenIterator
+	}
+
+	if campaign.Checkpoints != nil && campaign.ID == "" {
+		return nil, ErrNoCampaignID
+	}
+
+	// Validate the message once, an invalid message would fail every batch
+	m := *c.Message
+	m.To, m.RegistrationIds = "", nil
+	if err := validateMessage(&m); err != nil {
+		return nil, err
+	}
+
+	r := &campaignRun{client: c, campaign: campaign, start: time.Now(), cursors: make(map[int64]string)}
+
+	if campaign.Checkpoints != nil {
+		cp, err := campaign.Checkpoints.Load(ctx, campaign.ID)
+		if err != nil {
+			return nil, err
+		}
+		if cp != nil {
+			r.cp = *cp
+		}
+	}
+
+	r.done = make(map[int64]bool, len(r.cp.Done))
+	for _, b := range r.cp.Done {
+		r.done[b] = true
+	}
+	r.resumed = r.cp.Sent + r.cp.Failed
+
+	if r.cp.Finished {
+		p := r.progress()
+		return &p, nil
+	}
+
+	err := r.run(ctx)
+
+	r.mu.Lock()
+	if err == nil {
+		r.cp.Finished = true
+	}
+	p := r.progress()
+	r.mu.Unlock()
+
+	// Save the last checkpoint even if ctx was canceled
+	if saveErr := r.save(context.WithoutCancel(ctx), true); err == nil {
+		err = saveErr
+	}
+
+	return &p, err
+}
+
+// campaignRun state of a run of a campaign
+type campaignRun struct {
+	client   *Client
+	campaign Campaign
+	start    time.Time
+	resumed  int
+
+	mu sync.Mutex
+	cp Checkpoint
+	// done batches after cp.Batch
+	done map[int64]bool
+	// cursors cursor after each batch not yet in the checkpoint
+	cursors  map[int64]string
+	lastSave time.Time
+
+	// saveMu keep the checkpoints saved in order
+	saveMu sync.Mutex
+}
+
+// run read the batches of the iterator and send them until the end or an error
+func (r *campaignRun) run(ctx context.Context) error {
+	concurrency := r.campaign.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultCampaignConcurrency
+	}
+
+	var limiter *rateLimiter
+	if r.campaign.RateLimit > 0 {
+		limiter = newRateLimiter(r.campaign.RateLimit)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, concurrency)
+		errs = make(chan error, 1)
+	)
+
+	defer wg.Wait()
+
+	r.mu.Lock()
+	cursor, batch := r.cp.Cursor, r.cp.Batch
+	r.mu.Unlock()
+
+	for ; ; batch++ {
+		select {
+		case err := <-errs:
+			return err
+		default:
+		}
+
+		tokens, next, err := r.campaign.Tokens.Next(ctx, cursor, maxRegistrationIds)
+		if err != nil {
+			return err
+		}
+		if len(tokens) == 0 {
+			break
+		}
+
+		r.mu.Lock()
+		r.cursors[batch] = next
+		skip := r.done[batch]
+		r.mu.Unlock()
+		cursor = next
+
+		// Completed before the checkpoint
+		if skip {
+			if err := r.complete(ctx, batch, 0, 0); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if limiter != nil {
+			if err := limiter.wait(ctx); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		// Stop if a batch failed while waiting for a slot
+		select {
+		case err := <-errs:
+			<-sem
+			return err
+		default:
+		}
+
+		wg.Add(1)
+		go func(batch int64, tokens []string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := r.send(ctx, batch, tokens); err != nil {
+				select {
+				case errs <- err:
+				default:
+				}
+			}
+		}(batch, tokens)
+	}
+
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+// send send the batch and complete it, a batch that can't be sent is not completed so it is
+// sent again when the campaign resumes
+func (r *campaignRun) send(ctx context.Context, batch int64, tokens []string) error {
+	return r.client.sendBatches(ctx, *r.client.Message, tokens, func(tokens []string, resp *Response, err error) error {
+		if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+			return ctxErr
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if r.campaign.OnBatch != nil {
+			r.campaign.OnBatch(tokens, resp, nil)
+		}
+
+		return r.complete(ctx, batch, resp.Success, resp.Failure)
+	})
+}
+
+// complete mark the batch as completed, advance the checkpoint and report the progress
+func (r *campaignRun) complete(ctx context.Context, batch int64, sent, failed int) error {
+	r.mu.Lock()
+	r.cp.Sent += sent
+	r.cp.Failed += failed
+	r.done[batch] = true
+
+	// Advance the cursor while the batches are completed
+	for r.done[r.cp.Batch] {
+		delete(r.done, r.cp.Batch)
+		r.cp.Cursor = r.cursors[r.cp.Batch]
+		delete(r.cursors, r.cp.Batch)
+		r.cp.Batch++
+	}
+	p := r.progress()
+	r.mu.Unlock()
+
+	if sent+failed > 0 && r.campaign.OnProgress != nil {
+		r.campaign.OnProgress(p)
+	}
+
+	return r.save(ctx, false)
+}
+
+// progress return the progress of the run, r.mu must be held
+func (r *campaignRun) progress() CampaignProgress {
+	p := CampaignProgress{
+		Sent:      r.cp.Sent,
+		Failed:    r.cp.Failed,
+		Remaining: -1,
+		Elapsed:   time.Since(r.start),
+	}
+
+	if r.campaign.Total <= 0 {
+		return p
+	}
+
+	p.Remaining = r.campaign.Total - p.Sent - p.Failed
+	if p.Remaining < 0 {
+		p.Remaining = 0
+	}
+
+	// Estimate with the rate of this run
+	if processed := p.Sent + p.Failed - r.resumed; processed > 0 {
+		p.ETA = time.Duration(float64(p.Elapsed) / float64(processed) * float64(p.Remaining))
+	}
+
+	return p
+}
+
+// save save the checkpoint if it is time or force is true
+func (r *campaignRun) save(ctx context.Context, force bool) error {
+	if r.campaign.Checkpoints == nil {
+		return nil
+	}
+
+	r.saveMu.Lock()
+	defer r.saveMu.Unlock()
+
+	r.mu.Lock()
+	now := time.Now()
+	if !force && now.Sub(r.lastSave) < r.campaign.CheckpointEvery {
+		r.mu.Unlock()
+		return nil
+	}
+	r.lastSave = now
+
+	cp := r.cp
+	cp.Done = make([]int64, 0, len(r.done))
+	for b := range r.done {
+		cp.Done = append(cp.Done, b)
+	}
+	r.mu.Unlock()
+
+	return r.campaign.Checkpoints.Save(ctx, r.campaign.ID, &cp)
+}
+
+// rateLimiter permit an event every interval
+type rateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// wait block until the next event is permitted or ctx is done
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,350 @@
+package fcm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newCampaignServer count the tokens received and fail the tokens prefixed with bad
+func newCampaignServer(received *sync.Map, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(requests, 1)
+
+		var m message
+		json.NewDecoder(req.Body).Decode(&m)
+
+		resp := Response{}
+		for _, t := range m.RegistrationIds {
+			n, _ := received.LoadOrStore(t, new(int32))
+			atomic.AddInt32(n.(*int32), 1)
+
+			if t[:3] == "bad" {
+				resp.Failure++
+				resp.Results = append(resp.Results, Result{Error: "NotRegistered"})
+				continue
+			}
+			resp.Success++
+			resp.Results = append(resp.Results, Result{MessageID: "1"})
+		}
+
+		json.NewEncoder(rw).Encode(resp)
+	}))
+}
+
+func campaignTokens(n int) SliceTokens {
+	tokens := make(SliceTokens, n)
+	for i := range tokens {
+		tokens[i] = fmt.Sprintf("token-%d", i)
+		if i%100 == 0 {
+			tokens[i] = fmt.Sprintf("bad-%d", i)
+		}
+	}
+
+	return tokens
+}
+
+func TestClient_RunCampaign(t *testing.T) {
+	t.Parallel()
+
+	var received sync.Map
+	var requests int32
+	server := newCampaignServer(&received, &requests)
+	defer server.Close()
+
+	tokens := campaignTokens(4500)
+
+	client := NewClient("key", WithEndpoints(Endpoints{FCM: server.URL}))
+	client.SetData(map[string]string{"msg": "hi"})
+
+	var mu sync.Mutex
+	var last CampaignProgress
+	var calls int
+	progress, err := client.RunCampaign(context.Background(), Campaign{
+		Tokens:      tokens,
+		Total:       len(tokens),
+		Concurrency: 2,
+		RateLimit:   1000,
+		OnProgress: func(p CampaignProgress) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			if p.Sent+p.Failed > last.Sent+last.Failed {
+				last = p
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 5 || calls != 5 {
+		t.Errorf("expected 5 batches, got %d requests and %d callbacks", requests, calls)
+	}
+
+	if progress.Sent != 4455 || progress.Failed != 45 || progress.Remaining != 0 {
+		t.Errorf("unexpected progress %+v", progress)
+	}
+
+	if last.Sent != progress.Sent || last.ETA != 0 {
+		t.Errorf("unexpected last progress %+v", last)
+	}
+}
+
+func TestClient_RunCampaignResume(t *testing.T) {
+	t.Parallel()
+
+	var received sync.Map
+	var requests int32
+	server := newCampaignServer(&received, &requests)
+	defer server.Close()
+
+	tokens := campaignTokens(5000)
+	store := FileCheckpointStore(t.TempDir())
+
+	client := NewClient("key", WithEndpoints(Endpoints{FCM: server.URL}))
+	client.SetData(map[string]string{"msg": "hi"})
+
+	// Stop the first run after 2 batches
+	ctx, cancel := context.WithCancel(context.Background())
+	var batches int32
+	campaign := Campaign{
+		ID:          "welcome",
+		Tokens:      tokens,
+		Total:       len(tokens),
+		Concurrency: 1,
+		Checkpoints: store,
+		OnBatch: func(tokens []string, resp *Response, err error) {
+			if atomic.AddInt32(&batches, 1) == 2 {
+				cancel()
+			}
+		},
+	}
+
+	if _, err := client.RunCampaign(ctx, campaign); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	cp, err := store.Load(context.Background(), "welcome")
+	if err != nil || cp == nil || cp.Batch != 2 || cp.Cursor != "2000" || cp.Finished {
+		t.Fatalf("unexpected checkpoint %+v %v", cp, err)
+	}
+
+	campaign.OnBatch = nil
+	progress, err := client.RunCampaign(context.Background(), campaign)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if progress.Sent+progress.Failed != len(tokens) {
+		t.Errorf("unexpected progress %+v", progress)
+	}
+
+	// Every token was sent once
+	received.Range(func(k, v interface{}) bool {
+		if n := atomic.LoadInt32(v.(*int32)); n != 1 {
+			t.Errorf("%s sent %d times", k, n)
+		}
+		return true
+	})
+
+	// A finished campaign is not sent again
+	before := atomic.LoadInt32(&requests)
+	if _, err := client.RunCampaign(context.Background(), campaign); err != nil {
+		t.Fatal(err)
+	}
+	if requests != before {
+		t.Errorf("expected no requests, got %d", requests-before)
+	}
+}
+
+func TestClient_RunCampaignTransientError(t *testing.T) {
+	t.Parallel()
+
+	var received sync.Map
+	var requests int32
+	backend := newCampaignServer(&received, &requests)
+	defer backend.Close()
+
+	// The second batch is rejected with 503 once
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 2 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		backend.Config.Handler.ServeHTTP(rw, req)
+	}))
+	defer server.Close()
+
+	tokens := campaignTokens(3000)
+	store := FileCheckpointStore(t.TempDir())
+
+	client := NewClient("key", WithEndpoints(Endpoints{FCM: server.URL}))
+	client.SetData(map[string]string{"msg": "hi"})
+
+	campaign := Campaign{
+		ID:          "outage",
+		Tokens:      tokens,
+		Concurrency: 1,
+		Checkpoints: store,
+	}
+
+	_, err := client.RunCampaign(context.Background(), campaign)
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %v", err)
+	}
+
+	cp, err := store.Load(context.Background(), "outage")
+	if err != nil || cp == nil || cp.Batch != 1 || cp.Cursor != "1000" || cp.Failed != 10 {
+		t.Fatalf("expected only the first batch completed, got %+v %v", cp, err)
+	}
+
+	progress, err := client.RunCampaign(context.Background(), campaign)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if progress.Sent != 2970 || progress.Failed != 30 {
+		t.Errorf("unexpected progress %+v", progress)
+	}
+
+	// Every token was sent once
+	received.Range(func(k, v interface{}) bool {
+		if n := atomic.LoadInt32(v.(*int32)); n != 1 {
+			t.Errorf("%s sent %d times", k, n)
+		}
+		return true
+	})
+}
+
+func TestClient_RunCampaignUnauthorized(t *testing.T) {
+	t.Parallel()
+
+	var received sync.Map
+	var requests int32
+	server := newCampaignServer(&received, &requests)
+	defer server.Close()
+
+	// The key is revoked until it is rotated
+	var revoked int32 = 1
+	auth := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if atomic.LoadInt32(&revoked) == 1 {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		server.Config.Handler.ServeHTTP(rw, req)
+	}))
+	defer auth.Close()
+
+	store := FileCheckpointStore(t.TempDir())
+	client := NewClient("key", WithEndpoints(Endpoints{FCM: auth.URL}))
+	client.SetData(map[string]string{"msg": "hi"})
+
+	campaign := Campaign{ID: "revoked", Tokens: campaignTokens(5000), Checkpoints: store}
+
+	progress, err := client.RunCampaign(context.Background(), campaign)
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+
+	if progress.Sent != 0 || progress.Failed != 0 {
+		t.Errorf("expected no tokens counted, got %+v", progress)
+	}
+
+	cp, err := store.Load(context.Background(), "revoked")
+	if err != nil || cp == nil || cp.Finished || cp.Batch != 0 || cp.Failed != 0 {
+		t.Fatalf("expected the campaign not finished, got %+v %v", cp, err)
+	}
+
+	atomic.StoreInt32(&revoked, 0)
+	progress, err = client.RunCampaign(context.Background(), campaign)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if progress.Sent != 4950 || progress.Failed != 50 {
+		t.Errorf("unexpected progress %+v", progress)
+	}
+}
+
+func TestClient_RunCampaignInvalidMessage(t *testing.T) {
+	t.Parallel()
+
+	var received sync.Map
+	var requests int32
+	server := newCampaignServer(&received, &requests)
+	defer server.Close()
+
+	store := FileCheckpointStore(t.TempDir())
+	client := NewClient("key", WithEndpoints(Endpoints{FCM: server.URL}))
+	client.SetData(map[string]string{"msg": "hi"})
+	client.Message.FcmOptions = &FcmOptions{AnalyticsLabel: "not a valid label!"}
+
+	_, err := client.RunCampaign(context.Background(), Campaign{ID: "invalid", Tokens: campaignTokens(5000), Checkpoints: store})
+	if !errors.Is(err, ErrInvalidAnalyticsLabel) {
+		t.Fatalf("expected ErrInvalidAnalyticsLabel, got %v", err)
+	}
+
+	if requests != 0 {
+		t.Errorf("expected no requests, got %d", requests)
+	}
+
+	if cp, _ := store.Load(context.Background(), "invalid"); cp != nil {
+		t.Errorf("expected no checkpoint, got %+v", cp)
+	}
+}
+
+func TestCampaignRun_CompleteOutOfOrder(t *testing.T) {
+	t.Parallel()
+
+	r := &campaignRun{
+		client:   NewClient("key"),
+		campaign: Campaign{Checkpoints: FileCheckpointStore(t.TempDir()), ID: "c"},
+		start:    time.Now(),
+		done:     make(map[int64]bool),
+		cursors:  map[int64]string{0: "a", 1: "b", 2: "c"},
+	}
+
+	ctx := context.Background()
+	r.complete(ctx, 1, 1, 0)
+	r.complete(ctx, 2, 1, 0)
+
+	cp, _ := r.campaign.Checkpoints.Load(ctx, "c")
+	if cp.Batch != 0 || len(cp.Done) != 2 {
+		t.Errorf("expected batches 1 and 2 done after 0, got %+v", cp)
+	}
+
+	r.complete(ctx, 0, 1, 0)
+	cp, _ = r.campaign.Checkpoints.Load(ctx, "c")
+	if cp.Batch != 3 || cp.Cursor != "c" || len(cp.Done) != 0 || cp.Sent != 3 {
+		t.Errorf("unexpected checkpoint %+v", cp)
+	}
+}
+
+func TestSliceTokens(t *testing.T) {
+	t.Parallel()
+
+	s := SliceTokens{"a", "b", "c"}
+	tokens, next, _ := s.Next(context.Background(), "", 2)
+	if len(tokens) != 2 || next != "2" {
+		t.Errorf("unexpected %v %s", tokens, next)
+	}
+
+	tokens, next, _ = s.Next(context.Background(), next, 2)
+	if len(tokens) != 1 || next != "3" {
+		t.Errorf("unexpected %v %s", tokens, next)
+	}
+
+	if tokens, _, _ = s.Next(context.Background(), next, 2); len(tokens) != 0 {
+		t.Errorf("expected end, got %v", tokens)
+	}
+}
@@ -0,0 +1,155 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+const (
+	// Default number of tokens validated at the same time
+	defaultConcurrency = 10
+)
+
+// TokenReport result of validate the RegistrationIds against the IID service
+type TokenReport struct {
+	// Valid tokens accepted by IID
+	Valid []string
+	// Invalid map of token and reason for the tokens rejected by IID
+	Invalid map[string]string
+	// Undetermined map of token and reason for the tokens that could not be validated,
+	// e.g. network errors, server errors or cancellation. These tokens are kept
+	Undetermined map[string]string
+}
+
+// SetConcurrency set the max number of tokens validated at the same time
+func (c *Client) SetConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	c.concurrency = n
+}
+
+// CleanRegistrationIds remove invalid token of RegistrationIds and return list of BadTokens,
+// tokens that could not be validated are kept
+func (c *Client) CleanRegistrationIds() []string {
+	ids := c.Message.RegistrationIds
+	report, _ := c.CleanRegistrationIdsContext(context.Background())
+
+	var badTokens []string
+	for _, t := range ids {
+		if _, ok := report.Invalid[t]; ok {
+			badTokens = append(badTokens, t)
+		}
+	}
+
+	return badTokens
+}
+
+// CleanRegistrationIdsContext validate the RegistrationIds concurrently, remove the tokens rejected by IID
+// and return a report. If ctx is done the tokens not validated yet are reported as undetermined
+// and ctx.Err() is returned with the report
+func (c *Client) CleanRegistrationIdsContext(ctx context.Context) (*TokenReport, error) {
+	report, err := c.ValidateTokens(ctx, c.Message.RegistrationIds)
+
+	// Keep valid and undetermined tokens
+	var tokens []string
+	for _, t := range c.Message.RegistrationIds {
+		if _, ok := report.Invalid[t]; !ok {
+			tokens = append(tokens, t)
+		}
+	}
+	c.Message.RegistrationIds = tokens
+
+	return report, err
+}
+
+// ValidateTokens validate the tokens concurrently against the IID service and return a report
+func (c *Client) ValidateTokens(ctx context.Context, tokens []string) (*TokenReport, error) {
+	report := &TokenReport{
+		Invalid:      make(map[string]string),
+		Undetermined: make(map[string]string),
+	}
+
+	concurrency := c.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, concurrency)
+	)
+
+	seen := make(map[string]bool)
+	valid := make(map[string]bool)
+
+	for _, t := range tokens {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			mu.Lock()
+			report.Undetermined[t] = ctx.Err().Error()
+			mu.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func(t string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			ok, reason := c.checkToken(ctx, t)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case ok:
+				valid[t] = true
+			case reason.undetermined:
+				report.Undetermined[t] = reason.msg
+			default:
+				report.Invalid[t] = reason.msg
+			}
+		}(t)
+	}
+
+	wg.Wait()
+
+	// Keep the order of tokens in Valid
+	for _, t := range tokens {
+		if valid[t] {
+			report.Valid = append(report.Valid, t)
+			delete(valid, t)
+		}
+	}
+
+	return report, ctx.Err()
+}
+
+// tokenReason reason of a token is not valid
+type tokenReason struct {
+	msg          string
+	undetermined bool
+}
+
+// checkToken validate token t, a token is only invalid when IID reject it
+func (c *Client) checkToken(ctx context.Context, t string) (bool, tokenReason) {
+	_, err := c.getTokenDetails(ctx, t)
+	if err == nil {
+		return true, tokenReason{}
+	}
+
+	var te *TokenError
+	if errors.As(err, &te) {
+		return false, tokenReason{msg: te.Reason}
+	}
+
+	return false, tokenReason{msg: err.Error(), undetermined: true}
+}
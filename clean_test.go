@@ -0,0 +1,101 @@
+package fcm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient_CleanRegistrationIdsContext(t *testing.T) {
+	t.Parallel()
+
+	var current, max int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		defer atomic.AddInt32(&current, -1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		switch strings.TrimPrefix(req.URL.Path, "/iid/info/") {
+		case "invalid":
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(rw, `{"error":"InvalidToken"}`)
+		case "unavailable":
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			rw.WriteHeader(http.StatusOK)
+			fmt.Fprint(rw, `{"application":"com.iid.example"}`)
+		}
+	}))
+
+	defer server.Close()
+
+	tokens := []string{"invalid", "unavailable"}
+	for i := 0; i < 20; i++ {
+		tokens = append(tokens, fmt.Sprintf("token_%d", i))
+	}
+
+	client := NewClient("test")
+	client.Endpoints.IID = server.URL
+	client.SetConcurrency(4)
+	client.PushMultiple(tokens, map[string]string{"body": "Test"})
+
+	report, err := client.CleanRegistrationIdsContext(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if max > 4 {
+		t.Errorf("expected at most 4 concurrent requests, got %d", max)
+	}
+
+	if len(report.Valid) != 20 {
+		t.Errorf("expected 20, got %d", len(report.Valid))
+	}
+
+	if report.Invalid["invalid"] != "InvalidToken" {
+		t.Errorf("expected InvalidToken, got %q", report.Invalid["invalid"])
+	}
+
+	if _, ok := report.Undetermined["unavailable"]; !ok {
+		t.Error("expected unavailable token undetermined")
+	}
+
+	if len(client.Message.RegistrationIds) != 21 {
+		t.Errorf("expected 21, got %d", len(client.Message.RegistrationIds))
+	}
+}
+
+func TestClient_CleanRegistrationIdsContextCanceled(t *testing.T) {
+	t.Parallel()
+
+	client := NewClient("test")
+	client.Endpoints.IID = "http://127.0.0.1:0"
+	client.PushMultiple([]string{"token_1", "token_2"}, map[string]string{"body": "Test"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report, err := client.CleanRegistrationIdsContext(ctx)
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	if len(report.Undetermined) != 2 {
+		t.Errorf("expected 2, got %d", len(report.Undetermined))
+	}
+
+	if len(client.Message.RegistrationIds) != 2 {
+		t.Errorf("expected 2, got %d", len(client.Message.RegistrationIds))
+	}
+}
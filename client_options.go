@@ -0,0 +1,161 @@
+package fcm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// Default timeouts of the transport
+	defaultDialTimeout           = 30 * time.Second
+	defaultKeepAlive             = 30 * time.Second
+	defaultTLSHandshakeTimeout   = 10 * time.Second
+	defaultResponseHeaderTimeout = 10 * time.Second
+	defaultExpectContinueTimeout = 1 * time.Second
+)
+
+// ClientOption configure the client created by NewClient
+type ClientOption func(c *Client)
+
+// newTransport create the default transport
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Dial: (&net.Dialer{
+			Timeout:   defaultDialTimeout,
+			KeepAlive: defaultKeepAlive,
+		}).Dial,
+		TLSHandshakeTimeout:   defaultTLSHandshakeTimeout,
+		ResponseHeaderTimeout: defaultResponseHeaderTimeout,
+		ExpectContinueTimeout: defaultExpectContinueTimeout,
+	}
+}
+
+// transport return the transport of the default HTTPClient, nil if it was replaced
+func (c *Client) transport() *http.Transport {
+	t, _ := c.clientHttp.Transport.(*http.Transport)
+	return t
+}
+
+// withTransport return an option that call fn with the transport of the default HTTPClient
+func withTransport(fn func(t *http.Transport)) ClientOption {
+	return func(c *Client) {
+		if t := c.transport(); t != nil {
+			fn(t)
+		}
+	}
+}
+
+// WithTimeout set the timeout of the whole request, by default there is no timeout
+func WithTimeout(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.clientHttp.Timeout = d
+	}
+}
+
+// WithDialTimeout set the timeout to establish the connections, 30s by default
+func WithDialTimeout(d time.Duration) ClientOption {
+	return withTransport(func(t *http.Transport) {
+		t.Dial = (&net.Dialer{
+			Timeout:   d,
+			KeepAlive: defaultKeepAlive,
+		}).Dial
+	})
+}
+
+// WithTLSHandshakeTimeout set the timeout of the TLS handshake, 10s by default
+func WithTLSHandshakeTimeout(d time.Duration) ClientOption {
+	return withTransport(func(t *http.Transport) {
+		t.TLSHandshakeTimeout = d
+	})
+}
+
+// WithResponseHeaderTimeout set the timeout to wait the headers of the response, 10s by default
+func WithResponseHeaderTimeout(d time.Duration) ClientOption {
+	return withTransport(func(t *http.Transport) {
+		t.ResponseHeaderTimeout = d
+	})
+}
+
+// WithMaxIdleConnsPerHost set the idle connections kept per host
+func WithMaxIdleConnsPerHost(n int) ClientOption {
+	return withTransport(func(t *http.Transport) {
+		t.MaxIdleConnsPerHost = n
+	})
+}
+
+// WithHTTP2 enable HTTP/2, disabled by default
+func WithHTTP2() ClientOption {
+	return withTransport(func(t *http.Transport) {
+		t.ForceAttemptHTTP2 = true
+	})
+}
+
+// WithProxy send the requests through the proxy u
+func WithProxy(u *url.URL) ClientOption {
+	return withTransport(func(t *http.Transport) {
+		t.Proxy = http.ProxyURL(u)
+	})
+}
+
+// WithRootCAs verify the certificates of the servers with the pool instead of the system roots
+func WithRootCAs(pool *x509.CertPool) ClientOption {
+	return withTransport(func(t *http.Transport) {
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		t.TLSClientConfig.RootCAs = pool
+	})
+}
+
+// WithUserAgent set the User-Agent header of the requests
+func WithUserAgent(ua string) ClientOption {
+	return func(c *Client) {
+		c.userAgent = ua
+	}
+}
+
+// WithEndpoints set the endpoints used by the client
+func WithEndpoints(e Endpoints) ClientOption {
+	return func(c *Client) {
+		c.Endpoints = e
+	}
+}
+
+// WithHTTPClient use a specific HTTPClient, the options of the transport are ignored after it
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *Client) {
+		c.clientHttp = client
+	}
+}
+
+// WithCredentials set the primary credential and the secondary one used when FCM reject the primary
+func WithCredentials(primary, secondary Credential) ClientOption {
+	return func(c *Client) {
+		c.SetCredentials(primary, secondary)
+	}
+}
+
+// WithPrimaryRetry try the primary credential again d after failing over to the secondary
+func WithPrimaryRetry(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.SetPrimaryRetry(d)
+	}
+}
+
+// WithCircuitBreaker execute the operations of the client through the circuit breaker b
+func WithCircuitBreaker(b *CircuitBreaker) ClientOption {
+	return func(c *Client) {
+		c.Use(b.Middleware())
+	}
+}
+
+// WithDeduplicator deduplicate the messages with idempotency key sent by the client
+func WithDeduplicator(d *Deduplicator) ClientOption {
+	return func(c *Client) {
+		c.Use(d.Middleware())
+	}
+}
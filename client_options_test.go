@@ -0,0 +1,103 @@
+package fcm
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestNewClient_Defaults(t *testing.T) {
+	t.Parallel()
+
+	client := NewClient("key")
+	transport := client.transport()
+
+	if client.HTTPClient().Timeout != 0 {
+		t.Errorf("expected no timeout, got %v", client.HTTPClient().Timeout)
+	}
+
+	if transport.TLSHandshakeTimeout != defaultTLSHandshakeTimeout || transport.ResponseHeaderTimeout != defaultResponseHeaderTimeout {
+		t.Errorf("unexpected transport timeouts %v %v", transport.TLSHandshakeTimeout, transport.ResponseHeaderTimeout)
+	}
+
+	if transport.ForceAttemptHTTP2 || transport.Proxy != nil || transport.TLSClientConfig != nil {
+		t.Error("expected default transport")
+	}
+}
+
+func TestNewClient_Options(t *testing.T) {
+	t.Parallel()
+
+	proxy, _ := url.Parse("http://proxy:3128")
+	endpoints := Endpoints{FCM: "https://fcm.example.com"}
+
+	client := NewClient("key",
+		WithTimeout(5*time.Second),
+		WithTLSHandshakeTimeout(time.Second),
+		WithResponseHeaderTimeout(2*time.Second),
+		WithMaxIdleConnsPerHost(50),
+		WithHTTP2(),
+		WithProxy(proxy),
+		WithRootCAs(x509.NewCertPool()),
+		WithEndpoints(endpoints),
+	)
+	transport := client.transport()
+
+	if client.HTTPClient().Timeout != 5*time.Second {
+		t.Errorf("expected 5s, got %v", client.HTTPClient().Timeout)
+	}
+
+	if transport.TLSHandshakeTimeout != time.Second || transport.ResponseHeaderTimeout != 2*time.Second {
+		t.Errorf("unexpected transport timeouts %v %v", transport.TLSHandshakeTimeout, transport.ResponseHeaderTimeout)
+	}
+
+	if transport.MaxIdleConnsPerHost != 50 || !transport.ForceAttemptHTTP2 {
+		t.Error("expected 50 idle conns and HTTP/2")
+	}
+
+	req, _ := http.NewRequest(GET, "https://fcm.googleapis.com", nil)
+	if u, _ := transport.Proxy(req); u == nil || u.Host != "proxy:3128" {
+		t.Errorf("expected proxy, got %v", u)
+	}
+
+	if transport.TLSClientConfig == nil || transport.TLSClientConfig.RootCAs == nil {
+		t.Error("expected root CAs")
+	}
+
+	if client.Endpoints != endpoints {
+		t.Errorf("expected %+v, got %+v", endpoints, client.Endpoints)
+	}
+}
+
+func TestNewClient_RootCAsAndUserAgent(t *testing.T) {
+	t.Parallel()
+
+	var userAgent string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		userAgent = req.Header.Get("User-Agent")
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(`{"success": 1, "results": [{"message_id": "1"}]}`))
+	}))
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	client := NewClient("key",
+		WithRootCAs(pool),
+		WithUserAgent("my-app/1.0"),
+		WithEndpoints(Endpoints{FCM: server.URL}),
+	)
+	client.PushSingle("token", map[string]string{"msg": "hi"})
+
+	if _, err := client.Send(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if userAgent != "my-app/1.0" {
+		t.Errorf("expected my-app/1.0, got %q", userAgent)
+	}
+}
@@ -0,0 +1,277 @@
+package fcm
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Scope of the access tokens of service accounts
+	messagingScope = "https://www.googleapis.com/auth/firebase.messaging"
+	// Lifetime requested for the access tokens
+	accessTokenLifetime = time.Hour
+	// Access tokens are refreshed this time before they expire
+	accessTokenLeeway = time.Minute
+)
+
+var (
+	// Errors
+	ErrUnauthorized      = errors.New("unauthorized")
+	ErrInvalidPrivateKey = errors.New("private key of service account must be a PEM encoded RSA key")
+)
+
+// Credential authorize the requests of the client
+type Credential interface {
+	// Authorization return the value of the Authorization header of a request of c
+	Authorization(ctx context.Context, c *Client) (string, error)
+}
+
+// APIKey server key of the project
+type APIKey string
+
+// Authorization return the header of the key
+func (k APIKey) Authorization(ctx context.Context, c *Client) (string, error) {
+	return fmt.Sprintf("key=%v", string(k)), nil
+}
+
+// ServiceAccount credential that exchange a signed JWT for OAuth2 access tokens using
+// the Token endpoint of the client, the tokens are cached until they expire
+type ServiceAccount struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewServiceAccount create a ServiceAccount from the JSON key file of a service account
+func NewServiceAccount(jsonKey []byte) (*ServiceAccount, error) {
+	sa := new(ServiceAccount)
+	if err := json.Unmarshal(jsonKey, sa); err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, ErrInvalidPrivateKey
+		}
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidPrivateKey
+	}
+	sa.key = key
+
+	return sa, nil
+}
+
+// Authorization return the header of a valid access token, requesting a new one if needed
+func (sa *ServiceAccount) Authorization(ctx context.Context, c *Client) (string, error) {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	if sa.token == "" || time.Now().Add(accessTokenLeeway).After(sa.expiry) {
+		if err := sa.refresh(ctx, c); err != nil {
+			return "", err
+		}
+	}
+
+	return "Bearer " + sa.token, nil
+}
+
+// accessToken response of the OAuth2 token service
+type accessToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// refresh request a new access token
+func (sa *ServiceAccount) refresh(ctx context.Context, c *Client) error {
+	tokenURL := c.Endpoints.oauthTokenURL()
+
+	assertion, err := sa.assertion(tokenURL, time.Now())
+	if err != nil {
+		return err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+
+	request, err := http.NewRequestWithContext(ctx, POST, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.clientHttp.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newHTTPError(resp)
+	}
+
+	at := new(accessToken)
+	if err := json.NewDecoder(resp.Body).Decode(at); err != nil {
+		return err
+	}
+
+	sa.token = at.AccessToken
+	sa.expiry = time.Now().Add(time.Duration(at.ExpiresIn) * time.Second)
+
+	return nil
+}
+
+// assertion return the JWT signed by the service account to request an access token of aud
+func (sa *ServiceAccount) assertion(aud string, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": sa.PrivateKeyID})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   sa.ClientEmail,
+		"scope": messagingScope,
+		"aud":   aud,
+		"iat":   now.Unix(),
+		"exp":   now.Add(accessTokenLifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+
+	sum := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, sa.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + enc.EncodeToString(signature), nil
+}
+
+// UnauthorizedError error returned when FCM reject the credential with 401
+type UnauthorizedError struct {
+	// Secondary is true if the credential rejected is the secondary one
+	Secondary bool
+	// Err is the HTTPError of the response
+	Err *HTTPError
+}
+
+func (e *UnauthorizedError) Error() string {
+	which := "primary"
+	if e.Secondary {
+		which = "secondary"
+	}
+
+	return fmt.Sprintf("%s credential: %v", which, e.Err)
+}
+
+func (e *UnauthorizedError) Unwrap() []error {
+	return []error{ErrUnauthorized, e.Err}
+}
+
+// SetCredentials set the primary credential and the secondary one used when FCM reject the primary,
+// secondary can be nil
+func (c *Client) SetCredentials(primary, secondary Credential) {
+	c.credMu.Lock()
+	defer c.credMu.Unlock()
+
+	c.credentials = []Credential{primary}
+	if secondary != nil {
+		c.credentials = append(c.credentials, secondary)
+	}
+	c.activeCredential = 0
+}
+
+// OnUnauthorized call fn every time FCM reject a credential, e.g. to page someone when they are revoked
+func (c *Client) OnUnauthorized(fn func(err *UnauthorizedError)) {
+	c.credMu.Lock()
+	defer c.credMu.Unlock()
+
+	c.onUnauthorized = fn
+}
+
+// SetPrimaryRetry try the primary credential again d after failing over to the secondary,
+// e.g. when the primary was rejected while it was rotated. Zero, the default, keeps the
+// secondary until SetCredentials is called
+func (c *Client) SetPrimaryRetry(d time.Duration) {
+	c.credMu.Lock()
+	defer c.credMu.Unlock()
+
+	c.primaryRetry = d
+}
+
+// credential return the credential in use and its index
+func (c *Client) credential() (int, Credential) {
+	c.credMu.Lock()
+	defer c.credMu.Unlock()
+
+	if c.activeCredential > 0 && c.primaryRetry > 0 && time.Since(c.failedOverAt) >= c.primaryRetry {
+		c.activeCredential = 0
+	}
+
+	return c.activeCredential, c.credentials[c.activeCredential]
+}
+
+// unauthorized report that FCM rejected the credential i and return true if there is
+// another credential to retry
+func (c *Client) unauthorized(i int, httpErr *HTTPError) (bool, error) {
+	err := &UnauthorizedError{Secondary: i > 0, Err: httpErr}
+
+	c.credMu.Lock()
+	onUnauthorized := c.onUnauthorized
+	c.credMu.Unlock()
+
+	if onUnauthorized != nil {
+		onUnauthorized(err)
+	}
+
+	c.credMu.Lock()
+	defer c.credMu.Unlock()
+
+	// Other request already failed over
+	if c.activeCredential > i {
+		return true, err
+	}
+
+	if i+1 < len(c.credentials) {
+		c.activeCredential = i + 1
+		c.failedOverAt = time.Now()
+		return true, err
+	}
+
+	return false, err
+}
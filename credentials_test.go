@@ -0,0 +1,247 @@
+package fcm
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newUnauthorizedServer(validKey string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != validKey {
+			rw.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(rw, "<HTML><HEAD><TITLE>Unauthorized</TITLE></HEAD></HTML>")
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(rw, `{"success": 1, "results": [{"message_id": "1"}]}`)
+	}))
+}
+
+func TestClient_CredentialsFailover(t *testing.T) {
+	t.Parallel()
+
+	server := newUnauthorizedServer("key=secondary")
+	defer server.Close()
+
+	var reported []*UnauthorizedError
+	client := NewClient("primary",
+		WithCredentials(APIKey("primary"), APIKey("secondary")),
+		WithEndpoints(Endpoints{FCM: server.URL}),
+	)
+	client.OnUnauthorized(func(err *UnauthorizedError) {
+		reported = append(reported, err)
+	})
+	var attempts []int
+	client.Use(func(next Handler) Handler {
+		return func(op *Operation) error {
+			err := next(op)
+			attempts = append(attempts, op.Attempt)
+			return err
+		}
+	})
+	client.PushSingle("token", map[string]string{"msg": "hi"})
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Send(); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+
+	if fmt.Sprint(attempts) != "[2 1]" {
+		t.Errorf("expected attempts [2 1], got %v", attempts)
+	}
+
+	if len(reported) != 1 || reported[0].Secondary || reported[0].Err.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected primary reported once, got %v", reported)
+	}
+
+	if i, _ := client.credential(); i != 1 {
+		t.Errorf("expected secondary credential in use, got %d", i)
+	}
+}
+
+func TestClient_CredentialsPrimaryRetry(t *testing.T) {
+	t.Parallel()
+
+	var valid atomic.Value
+	valid.Store("key=secondary")
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != valid.Load().(string) {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(rw, `{"success": 1, "results": [{"message_id": "1"}]}`)
+	}))
+	defer server.Close()
+
+	client := NewClient("primary",
+		WithCredentials(APIKey("primary"), APIKey("secondary")),
+		WithEndpoints(Endpoints{FCM: server.URL}),
+		WithPrimaryRetry(50*time.Millisecond),
+	)
+	client.PushSingle("token", map[string]string{"msg": "hi"})
+
+	if _, err := client.Send(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if i, _ := client.credential(); i != 1 {
+		t.Fatalf("expected secondary credential in use, got %d", i)
+	}
+
+	// The primary is valid again after its rotation
+	valid.Store("key=primary")
+	time.Sleep(60 * time.Millisecond)
+
+	if _, err := client.Send(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if i, _ := client.credential(); i != 0 {
+		t.Errorf("expected primary credential in use, got %d", i)
+	}
+}
+
+func TestClient_CredentialsUnauthorized(t *testing.T) {
+	t.Parallel()
+
+	server := newUnauthorizedServer("key=other")
+	defer server.Close()
+
+	var reported int32
+	client := NewClient("primary", WithEndpoints(Endpoints{FCM: server.URL}))
+	client.SetCredentials(APIKey("primary"), APIKey("secondary"))
+	client.OnUnauthorized(func(err *UnauthorizedError) {
+		atomic.AddInt32(&reported, 1)
+	})
+	client.PushSingle("token", map[string]string{"msg": "hi"})
+
+	_, err := client.Send()
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+
+	var ue *UnauthorizedError
+	if !errors.As(err, &ue) || !ue.Secondary {
+		t.Errorf("expected secondary rejected, got %v", err)
+	}
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Message != "Unauthorized" {
+		t.Errorf("expected HTTPError, got %v", err)
+	}
+
+	if reported != 2 {
+		t.Errorf("expected 2 reports, got %d", reported)
+	}
+}
+
+func TestClient_CredentialsAttempts(t *testing.T) {
+	t.Parallel()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		rw.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	// The primary is retried on every request, both keys are revoked
+	client := NewClient("primary",
+		WithCredentials(APIKey("primary"), APIKey("secondary")),
+		WithEndpoints(Endpoints{FCM: server.URL}),
+		WithPrimaryRetry(time.Nanosecond),
+	)
+	client.PushSingle("token", map[string]string{"msg": "hi"})
+
+	if _, err := client.Send(); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+
+	if requests != 2 {
+		t.Errorf("expected 1 request per credential, got %d", requests)
+	}
+}
+
+func TestServiceAccount(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	jsonKey, _ := json.Marshal(map[string]string{
+		"client_email":   "fcm@project.iam.gserviceaccount.com",
+		"private_key_id": "kid",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	})
+
+	sa, err := NewServiceAccount(jsonKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tokens int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case oauthTokPath:
+			atomic.AddInt32(&tokens, 1)
+
+			parts := strings.Split(req.FormValue("assertion"), ".")
+			signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+			sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], signature); err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(rw, `{"error": "invalid_grant"}`)
+				return
+			}
+
+			fmt.Fprint(rw, `{"access_token": "access", "expires_in": 3600, "token_type": "Bearer"}`)
+		case fcmSendPath:
+			if req.Header.Get("Authorization") != "Bearer access" {
+				rw.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(rw, `{"success": 1, "results": [{"message_id": "1"}]}`)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient("", WithCredentials(sa, nil), WithEndpoints(Endpoints{FCM: server.URL, Token: server.URL}))
+	client.PushSingle("token", map[string]string{"msg": "hi"})
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Send(); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+
+	if tokens != 1 {
+		t.Errorf("expected access token cached, got %d requests", tokens)
+	}
+}
+
+func TestNewServiceAccount_InvalidKey(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewServiceAccount([]byte(`{"private_key": "nope"}`)); !errors.Is(err, ErrInvalidPrivateKey) {
+		t.Errorf("expected ErrInvalidPrivateKey, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package fcm
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	// Define default base urls
+	defaultBaseFCM   = "https://fcm.googleapis.com"
+	defaultBaseIID   = "https://iid.googleapis.com"
+	defaultBaseToken = "https://oauth2.googleapis.com"
+
+	// Define paths, {name} is replaced by the escaped value of name
+	fcmSendPath  = "/fcm/send"
+	iidInfoPath  = "/iid/info/{token}"
+	oauthTokPath = "/token"
+)
+
+// Endpoints base urls of the services used by the client, a base url can contain a path prefix
+// e.g. for a proxy, an empty base url uses the default one
+type Endpoints struct {
+	// FCM base url of the FCM connection server
+	FCM string
+	// IID base url of the Instance ID service
+	IID string
+	// Token base url of the OAuth2 token service used by service account credentials
+	Token string
+}
+
+// DefaultEndpoints return the endpoints of the Google services
+func DefaultEndpoints() Endpoints {
+	return Endpoints{
+		FCM:   defaultBaseFCM,
+		IID:   defaultBaseIID,
+		Token: defaultBaseToken,
+	}
+}
+
+// sendURL return the url to send messages
+func (e Endpoints) sendURL() string {
+	return buildURL(orDefault(e.FCM, defaultBaseFCM), fcmSendPath, nil, nil)
+}
+
+// tokenInfoURL return the url to get the details of token t
+func (e Endpoints) tokenInfoURL(t string) string {
+	return buildURL(
+		orDefault(e.IID, defaultBaseIID), iidInfoPath,
+		map[string]string{"token": t},
+		url.Values{"details": {"true"}},
+	)
+}
+
+// oauthTokenURL return the url to exchange credentials for an access token
+func (e Endpoints) oauthTokenURL() string {
+	return buildURL(orDefault(e.Token, defaultBaseToken), oauthTokPath, nil, nil)
+}
+
+// buildURL join base and path replacing the {name} of path by the escaped vars and add the query
+func buildURL(base, path string, vars map[string]string, query url.Values) string {
+	for k, v := range vars {
+		path = strings.Replace(path, "{"+k+"}", url.PathEscape(v), -1)
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		// The request fails with the parse error of base
+		return base + path
+	}
+
+	u = u.JoinPath(path)
+	if len(query) > 0 {
+		q := u.Query()
+		for k, v := range query {
+			q[k] = append(q[k], v...)
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	return u.String()
+}
+
+// sendURL return ApiFCM if set or the send url of the endpoints
+func (c *Client) sendURL() string {
+	if c.ApiFCM != "" {
+		return c.ApiFCM
+	}
+
+	return c.Endpoints.sendURL()
+}
+
+// tokenInfoURL return ApiIID if set or the token info url of the endpoints, an ApiIID
+// with a %s verb is formatted with the escaped token, otherwise the token is added to the query
+func (c *Client) tokenInfoURL(t string) string {
+	switch {
+	case c.ApiIID == "":
+		return c.Endpoints.tokenInfoURL(t)
+	case strings.Contains(c.ApiIID, "%s"):
+		return fmt.Sprintf(c.ApiIID, url.PathEscape(t))
+	default:
+		return c.ApiIID + "?token=" + url.QueryEscape(t)
+	}
+}
+
+// orDefault return s or d if s is empty
+func orDefault(s, d string) string {
+	if s == "" {
+		return d
+	}
+
+	return s
+}
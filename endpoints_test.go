@@ -0,0 +1,67 @@
+package fcm
+
+import (
+	"testing"
+)
+
+func TestEndpoints(t *testing.T) {
+	t.Parallel()
+
+	e := DefaultEndpoints()
+
+	if u := e.sendURL(); u != "https://fcm.googleapis.com/fcm/send" {
+		t.Errorf("expected default send url, got %s", u)
+	}
+
+	if u := e.tokenInfoURL("a/b:c?d"); u != "https://iid.googleapis.com/iid/info/a%2Fb:c%3Fd?details=true" {
+		t.Errorf("expected escaped token, got %s", u)
+	}
+
+	e = Endpoints{FCM: "http://proxy.local/eu/", IID: "http://proxy.local/iid"}
+
+	if u := e.sendURL(); u != "http://proxy.local/eu/fcm/send" {
+		t.Errorf("expected proxy send url, got %s", u)
+	}
+
+	if u := e.oauthTokenURL(); u != "https://oauth2.googleapis.com/token" {
+		t.Errorf("expected default token url, got %s", u)
+	}
+
+	e = Endpoints{FCM: "http://proxy.local/eu?key=1", IID: "http://proxy.local/iid/?key=1"}
+
+	if u := e.sendURL(); u != "http://proxy.local/eu/fcm/send?key=1" {
+		t.Errorf("expected path before the query of the base, got %s", u)
+	}
+
+	if u := e.tokenInfoURL("token"); u != "http://proxy.local/iid/iid/info/token?details=true&key=1" {
+		t.Errorf("expected merged query, got %s", u)
+	}
+}
+
+func TestClient_DeprecatedURLs(t *testing.T) {
+	t.Parallel()
+
+	client := NewClient("test")
+	client.Endpoints.FCM = "http://proxy.local"
+
+	if u := client.sendURL(); u != "http://proxy.local/fcm/send" {
+		t.Errorf("expected endpoints send url, got %s", u)
+	}
+
+	client.ApiFCM = "http://legacy.local/send"
+	client.ApiIID = "http://legacy.local/info"
+
+	if u := client.sendURL(); u != "http://legacy.local/send" {
+		t.Errorf("expected ApiFCM, got %s", u)
+	}
+
+	if u := client.tokenInfoURL("a/b"); u != "http://legacy.local/info?token=a%2Fb" {
+		t.Errorf("expected token in the query, got %s", u)
+	}
+
+	client.ApiIID = "http://legacy.local/info/%s?details=true"
+
+	if u := client.tokenInfoURL("a/b"); u != "http://legacy.local/info/a%2Fb?details=true" {
+		t.Errorf("expected formatted ApiIID, got %s", u)
+	}
+}
@@ -0,0 +1,158 @@
+package fcm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Max size of the body kept in HTTPError
+	maxErrorBodySize = 64 << 10
+)
+
+var (
+	// Code of the plain text errors of the legacy API, e.g. "JSON_PARSING_ERROR: Unexpected character"
+	legacyErrorRegexp = regexp.MustCompile(`^([A-Z][A-Z_]+):\s*(.*)`)
+	// Title of the html errors of the legacy API
+	htmlTitleRegexp = regexp.MustCompile(`(?is)<title>(.*?)</title>`)
+)
+
+// HTTPError error returned when FCM respond with a non-200 status
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	// Body of the response, truncated to 64KB
+	Body []byte
+	// Code of the error, e.g. JSON_PARSING_ERROR in the legacy API or UNREGISTERED in the v1 API
+	Code string
+	// Message detail of the error
+	Message string
+}
+
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("statusCode: %d error: %s", e.StatusCode, e.Status)
+
+	switch {
+	case e.Code != "" && e.Message != "":
+		msg += fmt.Sprintf(": %s: %s", e.Code, e.Message)
+	case e.Code != "":
+		msg += ": " + e.Code
+	case e.Message != "":
+		msg += ": " + e.Message
+	}
+
+	return msg
+}
+
+// RetryAfter return the duration of the Retry-After header, zero if absent
+func (e *HTTPError) RetryAfter() time.Duration {
+	v := e.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
+
+// Temporary return true if the request can be retried later
+func (e *HTTPError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// v1Error format of the errors of the v1 API
+type v1Error struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+		Details []struct {
+			Type      string `json:"@type"`
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// legacyError format of the json errors of the legacy and IID APIs
+type legacyError struct {
+	Error string `json:"error"`
+}
+
+// newHTTPError create HTTPError reading and decoding the body of resp
+func newHTTPError(resp *http.Response) *HTTPError {
+	e := &HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	e.Body = body
+	e.decode()
+
+	return e
+}
+
+// decode set Code and Message from the known error formats of the body
+func (e *HTTPError) decode() {
+	body := bytes.TrimSpace(e.Body)
+	if len(body) == 0 {
+		return
+	}
+
+	if body[0] == '{' {
+		var v1 v1Error
+		if err := json.Unmarshal(body, &v1); err == nil && (v1.Error.Status != "" || v1.Error.Message != "") {
+			e.Code = v1.Error.Status
+			e.Message = v1.Error.Message
+			for _, d := range v1.Error.Details {
+				if d.ErrorCode != "" {
+					e.Code = d.ErrorCode
+					break
+				}
+			}
+			return
+		}
+
+		var legacy legacyError
+		if err := json.Unmarshal(body, &legacy); err == nil && legacy.Error != "" {
+			e.Code = legacy.Error
+			return
+		}
+	}
+
+	text := string(body)
+	if m := htmlTitleRegexp.FindStringSubmatch(text); m != nil {
+		e.Message = strings.TrimSpace(m[1])
+		return
+	}
+
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i]
+	}
+
+	if m := legacyErrorRegexp.FindStringSubmatch(text); m != nil {
+		e.Code = m[1]
+		e.Message = strings.TrimSpace(m[2])
+		return
+	}
+
+	e.Message = strings.TrimSpace(text)
+}
@@ -0,0 +1,102 @@
+package fcm
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPError_Decode(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		body    string
+		code    string
+		message string
+	}{
+		{"legacy text", "JSON_PARSING_ERROR: Unexpected character (t) at position 0.\n", "JSON_PARSING_ERROR", "Unexpected character (t) at position 0."},
+		{"legacy html", "<HTML><HEAD><TITLE>The request was missing an Authentication Key.</TITLE></HEAD></HTML>", "", "The request was missing an Authentication Key."},
+		{"legacy json", `{"error": "InvalidToken"}`, "InvalidToken", ""},
+		{"v1", `{"error": {"code": 404, "message": "Requested entity was not found.", "status": "NOT_FOUND", "details": [{"@type": "type.googleapis.com/google.firebase.fcm.v1.FcmError", "errorCode": "UNREGISTERED"}]}}`, "UNREGISTERED", "Requested entity was not found."},
+		{"v1 without details", `{"error": {"code": 401, "message": "Request had invalid authentication credentials.", "status": "UNAUTHENTICATED"}}`, "UNAUTHENTICATED", "Request had invalid authentication credentials."},
+		{"empty", "", "", ""},
+	}
+
+	for _, c := range cases {
+		e := &HTTPError{Body: []byte(c.body)}
+		e.decode()
+
+		if e.Code != c.code || e.Message != c.message {
+			t.Errorf("%s: expected %q %q, got %q %q", c.name, c.code, c.message, e.Code, e.Message)
+		}
+	}
+}
+
+func TestHTTPError_RetryAfter(t *testing.T) {
+	t.Parallel()
+
+	e := &HTTPError{Header: http.Header{"Retry-After": []string{"120"}}}
+	if e.RetryAfter() != 2*time.Minute {
+		t.Errorf("expected 2m, got %v", e.RetryAfter())
+	}
+
+	e.Header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	if d := e.RetryAfter(); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("expected about 1h, got %v", d)
+	}
+
+	e.Header.Del("Retry-After")
+	if e.RetryAfter() != 0 {
+		t.Errorf("expected 0, got %v", e.RetryAfter())
+	}
+}
+
+func TestClient_SendHTTPError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Retry-After", "30")
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		rw.Write([]byte(strings.Repeat("x", 4*maxErrorBodySize)))
+	}))
+	defer server.Close()
+
+	client := NewClient("key", WithEndpoints(Endpoints{FCM: server.URL}))
+	client.PushSingle("token", map[string]string{"msg": "hi"})
+
+	var kept int
+	client.Use(func(next Handler) Handler {
+		return func(op *Operation) error {
+			err := next(op)
+			kept = len(op.ResponseBody)
+			return err
+		}
+	})
+
+	_, err := client.Send()
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("expected HTTPError, got %v", err)
+	}
+
+	if httpErr.StatusCode != http.StatusServiceUnavailable || !httpErr.Temporary() {
+		t.Errorf("expected temporary 503, got %d", httpErr.StatusCode)
+	}
+
+	if httpErr.RetryAfter() != 30*time.Second {
+		t.Errorf("expected 30s, got %v", httpErr.RetryAfter())
+	}
+
+	if len(httpErr.Body) != maxErrorBodySize {
+		t.Errorf("expected body truncated to %d, got %d", maxErrorBodySize, len(httpErr.Body))
+	}
+
+	if kept != maxErrorBodySize {
+		t.Errorf("expected body read up to %d, got %d", maxErrorBodySize, kept)
+	}
+}
@@ -2,11 +2,15 @@ package fcm
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net"
+	"io"
+	"log/slog"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,16 +19,24 @@ const (
 	GET  = "GET"
 	POST = "POST"
 
-	// Define Urls
-	defaultApiFCM = "https://fcm.googleapis.com/fcm/send"
-	defaultApiIID = "https://iid.googleapis.com/iid/info/%s?details=true"
-
 	// Set Max time to live for message
 	maxTTL = 2419200
 
+	// Max registration ids permit for FCM in a multicast message
+	maxRegistrationIds = 1000
+
 	// Priorities
 	HighPriority   = "high"
 	NormalPriority = "normal"
+
+	// Prefix of topics in the to field
+	topicPrefix = "/topics/"
+
+	// Types of target of a message
+	TargetToken     = "token"
+	TargetTopic     = "topic"
+	TargetCondition = "condition"
+	TargetGroup     = "group"
 )
 
 var (
@@ -33,22 +45,6 @@ var (
 	ErrToManyRegIDs = errors.New("too many registrations ids")
 )
 
-type NotificationPayload struct {
-	Title            string `json:"title,omitempty"`
-	Body             string `json:"body,omitempty"`
-	BodyLocKey       string `json:"body_loc_key,omitempty"`
-	BodyLocArgs      string `json:"body_loc_args,omitempty"`
-	Icon             string `json:"icon,omitempty"`
-	Tag              string `json:"tag,omitempty"`
-	Sound            string `json:"sound,omitempty"`
-	Badge            string `json:"badge,omitempty"`
-	Color            string `json:"color,omitempty"`
-	ClickAction      string `json:"click_action,omitempty"`
-	TitleLocKey      string `json:"title_loc_key,omitempty"`
-	TitleLocArgs     string `json:"title_loc_args,omitempty"`
-	AndroidChannelID string `json:"android_channel_id,omitempty"`
-}
-
 type message struct {
 	Data                  interface{}          `json:"data,omitempty"`
 	To                    string               `json:"to,omitempty"`
@@ -62,54 +58,91 @@ type message struct {
 	RestrictedPackageName string               `json:"restricted_package_name,omitempty"`
 	DryRun                bool                 `json:"dry_run,omitempty"`
 	TimeToLive            int                  `json:"time_to_live,omitempty"`
+	FcmOptions            *FcmOptions          `json:"fcm_options,omitempty"`
+	// DeliveryReceiptRequested request a delivery receipt, receipts are only sent through XMPP
+	DeliveryReceiptRequested bool `json:"delivery_receipt_requested,omitempty"`
+	// idempotencyKey key to deduplicate the sends of the message
+	idempotencyKey string
+	// group is true when To is the notification key of a device group
+	group bool
+}
+
+// TargetType return the type of target of the message
+func (m *message) TargetType() string {
+	switch {
+	case m.Condition != "":
+		return TargetCondition
+	case m.group:
+		return TargetGroup
+	case strings.HasPrefix(m.To, topicPrefix):
+		return TargetTopic
+	default:
+		return TargetToken
+	}
 }
 
 type tokenDetails struct {
-	Application      string `json:"application,omitempty"`
-	Platform         string `json:"platform,omitempty"`
-	AppSigner        string `json:"appSigner,omitempty"`
-	AttestStatus     string `json:"attestStatus,omitempty"`
-	AuthorizedEntity string `json:"authorizedEntity,omitempty"`
-	ConnectionType   string `json:"connectionType,omitempty"`
-	ConnectDate      string `json:"connectDate,omitempty"`
-	StatusCode       int
+	Application      string                                  `json:"application,omitempty"`
+	Platform         string                                  `json:"platform,omitempty"`
+	AppSigner        string                                  `json:"appSigner,omitempty"`
+	AttestStatus     string                                  `json:"attestStatus,omitempty"`
+	AuthorizedEntity string                                  `json:"authorizedEntity,omitempty"`
+	ConnectionType   string                                  `json:"connectionType,omitempty"`
+	ConnectDate      string                                  `json:"connectDate,omitempty"`
 	Error            string                                  `json:"error,omitempty"`
 	Rel              map[string]map[string]map[string]string `json:"rel,omitempty"`
 }
 
 type Client struct {
-	apiKey     string
 	Message    *message
 	clientHttp *http.Client
-	ApiFCM     string
-	ApiIID     string
+	Endpoints  Endpoints
+	resolver   TokenResolver
+	// concurrency max number of tokens validated at the same time
+	concurrency int
+	middlewares []Middleware
+	logger      *slog.Logger
+	logConfig   LogConfig
+	imageCheck  *ImageCheck
+	userAgent   string
+
+	// ApiFCM full url to send messages, overrides Endpoints when set.
+	//
+	// Deprecated: use Endpoints.FCM.
+	ApiFCM string
+	// ApiIID full url of the token details, overrides Endpoints when set. A %s in the url is
+	// replaced by the token, otherwise the token is sent in the token query parameter.
+	//
+	// Deprecated: use Endpoints.IID.
+	ApiIID string
+
+	credMu           sync.Mutex
+	credentials      []Credential
+	activeCredential int
+	onUnauthorized   func(err *UnauthorizedError)
+	// primaryRetry time after failing over to try the primary credential again
+	primaryRetry time.Duration
+	failedOverAt time.Time
 }
 
-// NewClient Create instance of client
-func NewClient(key string) *Client {
+// NewClient Create instance of client, the options are applied in order
+func NewClient(key string, opts ...ClientOption) *Client {
 	// Generate new client with apiKey
 	client := new(Client)
-	client.apiKey = key
+	client.credentials = []Credential{APIKey(key)}
 	client.Message = &message{}
 
 	// Create default HTTPClient
-	c := &http.Client{
-		Transport: &http.Transport{
-			Dial: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).Dial,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ResponseHeaderTimeout: 10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		},
-	}
-
-	client.clientHttp = c
+	client.clientHttp = &http.Client{Transport: newTransport()}
 
 	// Set default endpoints
-	client.ApiFCM = defaultApiFCM
-	client.ApiIID = defaultApiIID
+	client.Endpoints = DefaultEndpoints()
+
+	client.concurrency = defaultConcurrency
+
+	for _, opt := range opts {
+		opt(client)
+	}
 
 	return client
 }
@@ -119,6 +152,11 @@ func (c *Client) SetHTTPClient(client *http.Client) {
 	c.clientHttp = client
 }
 
+// HTTPClient return the HTTPClient used by the client
+func (c *Client) HTTPClient() *http.Client {
+	return c.clientHttp
+}
+
 // SetData Set data for message
 func (c *Client) SetData(d interface{}) {
 	c.Message.Data = d
@@ -133,12 +171,28 @@ func (c *Client) SetNotification(n *NotificationPayload) {
 func (c *Client) PushSingle(to string, d interface{}) {
 	c.SetData(d)
 	c.Message.To = to
+	c.Message.group = false
 }
 
 // PushSingleNotification send a notification to a single token
 func (c *Client) PushSingleNotification(to string, n *NotificationPayload) {
 	c.SetNotification(n)
 	c.Message.To = to
+	c.Message.group = false
+}
+
+// PushGroup send data to the device group of the notification key
+func (c *Client) PushGroup(key string, d interface{}) {
+	c.SetData(d)
+	c.Message.To = key
+	c.Message.group = true
+}
+
+// PushGroupNotification send a notification to the device group of the notification key
+func (c *Client) PushGroupNotification(key string, n *NotificationPayload) {
+	c.SetNotification(n)
+	c.Message.To = key
+	c.Message.group = true
 }
 
 // SetMsgAndIds Set Message and ids for send
@@ -158,43 +212,29 @@ func (c *Client) AppendRegistrationIds(ids []string) {
 	c.Message.RegistrationIds = append(c.Message.RegistrationIds, ids...)
 }
 
-// CleanRegistrationIds remove invalid token of RegistrationIds and return map of BadTokens
-func (c *Client) CleanRegistrationIds() []string {
-	var validTokens []string
-	var badTokens []string
-	for _, t := range c.Message.RegistrationIds {
-		details, err := c.GetTokenDetails(t)
-		if err == nil && details.Error == "" {
-			validTokens = append(validTokens, t)
-		} else {
-			badTokens = append(badTokens, t)
-		}
-	}
-
-	// Change RegistrationIds for validTokens
-	c.Message.RegistrationIds = validTokens
-
-	return badTokens
+// GetTokenDetails get info about the token, return a *TokenError if IID reject the token
+func (c *Client) GetTokenDetails(t string) (*TokenInfo, error) {
+	return c.GetTokenDetailsContext(context.Background(), t)
 }
 
-// GetTokenDetails get info about the token
-func (c *Client) GetTokenDetails(t string) (*tokenDetails, error) {
-
-	var url string
-	if c.ApiIID == defaultApiIID {
-		url = fmt.Sprintf(c.ApiIID, t)
-	} else {
-		url = c.ApiIID + fmt.Sprintf("?token=%s", t)
-	}
+// GetTokenDetailsContext get info about the token using ctx for the request
+func (c *Client) GetTokenDetailsContext(ctx context.Context, t string) (*TokenInfo, error) {
+	return c.getTokenDetails(ctx, t)
+}
 
-	resp, err := c.doRequest(GET, url, nil)
+// getTokenDetails get info about the token using ctx for the request
+func (c *Client) getTokenDetails(ctx context.Context, t string) (*TokenInfo, error) {
+	op := &Operation{Name: OpTokenDetails, Tokens: []string{t}}
+	err := c.doRequest(ctx, op, GET, c.tokenInfoURL(t), nil, func(resp *http.Response) (interface{}, error) {
+		return parseTokenDetails(resp)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	details, err := parseTokenDetails(resp)
-	if err != nil {
-		return nil, err
+	details, ok := op.Result.(*TokenInfo)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result %T", op.Result)
 	}
 
 	return details, nil
@@ -202,76 +242,207 @@ func (c *Client) GetTokenDetails(t string) (*tokenDetails, error) {
 }
 
 // Send Validate and Send FCM message
-func (c *Client) Send() (*response, error) {
-	err := c.validateData()
+func (c *Client) Send() (*Response, error) {
+	return c.SendContext(context.Background())
+}
+
+// SendContext Validate and Send FCM message using ctx for the request
+func (c *Client) SendContext(ctx context.Context) (*Response, error) {
+	return c.send(ctx, c.Message)
+}
+
+// send validate and send the message m
+func (c *Client) send(ctx context.Context, m *message) (*Response, error) {
+	err := validateMessage(m)
 	if err != nil {
 		return nil, err
 	}
 
-	b, err := json.Marshal(c.Message)
-	if err != nil {
-		return nil, err
+	if c.imageCheck != nil && m.Notification != nil && m.Notification.Image != "" {
+		if err := c.checkImage(ctx, m.Notification.Image); err != nil {
+			return nil, err
+		}
 	}
 
-	resp, err := c.doRequest(POST, c.ApiFCM, b)
+	b, err := json.Marshal(m)
 	if err != nil {
 		return nil, err
 	}
 
-	response, err := parseFcmResponse(resp)
+	op := &Operation{Name: OpSend, Message: m, Tokens: messageTokens(m)}
+	err = c.doRequest(ctx, op, POST, c.sendURL(), b, func(resp *http.Response) (interface{}, error) {
+		return parseFcmResponse(resp)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Copy registrations from Client to response
-	response.copyRegistrationIds = c.Message.RegistrationIds
+	response, ok := op.Result.(*Response)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result %T", op.Result)
+	}
+
+	// Copy registrations from message to response
+	response.copyRegistrationIds = m.RegistrationIds
 
 	return response, nil
 }
 
-// validateData return error if data is wrong
-func (c *Client) validateData() error {
+// sendBatches send copies of m to tokens in batches of 1000 ids so the client message is
+// left untouched, fn is called with the result of every batch and an error returned by fn
+// stops the sends
+func (c *Client) sendBatches(ctx context.Context, m message, tokens []string, fn func(batch []string, resp *Response, err error) error) error {
+	m.To, m.group = "", false
+	for start := 0; start < len(tokens); start += maxRegistrationIds {
+		m.RegistrationIds = tokens[start:min(start+maxRegistrationIds, len(tokens))]
+
+		resp, err := c.send(ctx, &m)
+		if err := fn(m.RegistrationIds, resp, err); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateMessage return error if data is wrong
+func validateMessage(m *message) error {
 	// Data and Notification is empty
-	if c.Message.Data == nil && c.Message.Notification == nil {
+	if m.Data == nil && m.Notification == nil {
 		return ErrDataIsEmpty
 	}
 
 	// Max token permit for FCM is 1000
-	if len(c.Message.RegistrationIds) > 1000 {
+	if len(m.RegistrationIds) > maxRegistrationIds {
 		return ErrToManyRegIDs
 	}
 
 	// Validate Priority
-	if c.Message.Priority != NormalPriority {
-		c.Message.Priority = HighPriority
+	if m.Priority != NormalPriority {
+		m.Priority = HighPriority
 	}
 
 	// Validate TimeToLive
-	if c.Message.TimeToLive > maxTTL {
-		c.Message.TimeToLive = maxTTL
+	if m.TimeToLive > maxTTL {
+		m.TimeToLive = maxTTL
+	}
+
+	// Validate Notification
+	if m.Notification != nil {
+		if err := m.Notification.validate(); err != nil {
+			return err
+		}
+	}
+
+	// Validate FcmOptions
+	if m.FcmOptions != nil {
+		if err := m.FcmOptions.Validate(); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// doRequest do request
-func (c *Client) doRequest(m string, url string, data []byte) (*http.Response, error) {
-	// Create request
-	request, err := http.NewRequest(m, url, bytes.NewBuffer(data))
+// doRequest build the request of op and execute the operation through the middlewares,
+// parse decode the response into op.Result
+func (c *Client) doRequest(ctx context.Context, op *Operation, m string, url string, data []byte, parse parseFunc) error {
+	// Create request, the authorization is set for every attempt
+	request, err := http.NewRequestWithContext(ctx, m, url, bytes.NewReader(data))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// Set headers
-	request.Header.Set("Authorization", fmt.Sprintf("key=%v", c.apiKey))
 	request.Header.Set("Content-Type", "application/json")
+	if c.userAgent != "" {
+		request.Header.Set("User-Agent", c.userAgent)
+	}
 
-	// Execute requests
-	resp, err := c.clientHttp.Do(request)
-	if err != nil {
-		return nil, err
+	op.Request = request
+	op.RequestBody = data
+
+	// Execute the operation
+	return c.chain(c.attempts(parse))(op)
+}
+
+// attempts return the handler that send the request of op with the active credential and send
+// it again with the next credential when FCM reject it, at most once per credential
+func (c *Client) attempts(parse parseFunc) Handler {
+	roundTrip := c.logMiddleware(c.roundTrip(parse))
+
+	return func(op *Operation) error {
+		// Request prepared by the middlewares, every attempt send a copy of it
+		base := op.Request
+
+		c.credMu.Lock()
+		max := len(c.credentials)
+		c.credMu.Unlock()
+
+		for {
+			i, credential := c.credential()
+			authorization, err := credential.Authorization(base.Context(), c)
+			if err != nil {
+				return err
+			}
+
+			request, err := http.NewRequestWithContext(base.Context(), base.Method, base.URL.String(), bytes.NewReader(op.RequestBody))
+			if err != nil {
+				return err
+			}
+			request.Header = base.Header.Clone()
+			request.Header.Set("Authorization", authorization)
+
+			op.Request = request
+			op.Attempt++
+			op.Response, op.ResponseBody, op.Result = nil, nil, nil
+
+			err = roundTrip(op)
+
+			var httpErr *HTTPError
+			if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusUnauthorized {
+				return err
+			}
+
+			// Retry with the next credential if FCM rejected the current one
+			retry, err := c.unauthorized(i, httpErr)
+			if !retry || op.Attempt >= max {
+				return err
+			}
+		}
 	}
+}
 
-	return resp, nil
+// roundTrip return the handler that execute the request of op and parse the response
+func (c *Client) roundTrip(parse parseFunc) Handler {
+	return func(op *Operation) error {
+		resp, err := c.clientHttp.Do(op.Request)
+		if err != nil {
+			return err
+		}
+
+		// Keep a copy of the body for the middlewares, error bodies are truncated
+		// so a misbehaving server can't exhaust the memory
+		var r io.Reader = resp.Body
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			r = io.LimitReader(resp.Body, maxErrorBodySize)
+		}
+		body, err := io.ReadAll(r)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
 
+		op.Response = resp
+		op.ResponseBody = body
+
+		result, err := parse(resp)
+		if err != nil {
+			return err
+		}
+		op.Result = result
+
+		return nil
+	}
 }
@@ -14,7 +14,7 @@ func TestNewClient(t *testing.T) {
 	key := "key"
 	client := NewClient(key)
 
-	if client.apiKey != key {
+	if client.credentials[0] != APIKey(key) {
 		t.Fatalf("expected apiKey %s", key)
 	}
 
@@ -397,3 +397,30 @@ func TestClient_Send(t *testing.T) {
 
 	})
 }
+
+func TestMessage_TargetType(t *testing.T) {
+	t.Parallel()
+
+	client := NewClient("key")
+	data := map[string]string{"body": "Test"}
+
+	client.PushSingle("token1", data)
+	if tt := client.Message.TargetType(); tt != TargetToken {
+		t.Errorf("expected %s, got %s", TargetToken, tt)
+	}
+
+	client.PushSingle("/topics/news", data)
+	if tt := client.Message.TargetType(); tt != TargetTopic {
+		t.Errorf("expected %s, got %s", TargetTopic, tt)
+	}
+
+	client.PushGroup("notification key", data)
+	if tt := client.Message.TargetType(); tt != TargetGroup {
+		t.Errorf("expected %s, got %s", TargetGroup, tt)
+	}
+
+	client.Message.Condition = "'news' in topics"
+	if tt := client.Message.TargetType(); tt != TargetCondition {
+		t.Errorf("expected %s, got %s", TargetCondition, tt)
+	}
+}
@@ -0,0 +1,243 @@
+package fcm
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	// Default number of keys kept by the memory store
+	defaultIdempotencyStoreSize = 10000
+	// Default time the keys are remembered
+	defaultIdempotencyWindow = 24 * time.Hour
+)
+
+// IdempotencyStore keep the results of the messages sent by idempotency key
+type IdempotencyStore interface {
+	// Get return the result saved for key, false if there is no one
+	Get(ctx context.Context, key string) (*Response, bool, error)
+	// Set save the result of key for ttl
+	Set(ctx context.Context, key string, r *Response, ttl time.Duration) error
+}
+
+// SetIdempotencyKey set the idempotency key of the message, a message sent again to the same recipients
+// with the same key return the original result instead of be sent when the client use a Deduplicator.
+// An empty key removes it
+func (c *Client) SetIdempotencyKey(key string) {
+	c.Message.idempotencyKey = key
+}
+
+// Deduplicator remember the results of the messages with idempotency key and return them when
+// the messages are sent again, it is added to a client with Use(d.Middleware())
+type Deduplicator struct {
+	store  IdempotencyStore
+	window time.Duration
+
+	mu       sync.Mutex
+	inflight map[string]*inflightSend
+}
+
+// inflightSend send of a key in progress, the concurrent sends of the key wait for it
+type inflightSend struct {
+	done   chan struct{}
+	result *Response
+	err    error
+}
+
+// NewDeduplicator create a Deduplicator that remember the keys for window in store,
+// by default a memory store of 10000 keys and 24h
+func NewDeduplicator(store IdempotencyStore, window time.Duration) *Deduplicator {
+	if store == nil {
+		store = NewMemoryStore(defaultIdempotencyStoreSize)
+	}
+	if window <= 0 {
+		window = defaultIdempotencyWindow
+	}
+
+	return &Deduplicator{
+		store:    store,
+		window:   window,
+		inflight: make(map[string]*inflightSend),
+	}
+}
+
+// Middleware return the middleware that deduplicate the messages with idempotency key
+func (d *Deduplicator) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return func(op *Operation) error {
+			if op.Name != OpSend || op.Message == nil || op.Message.idempotencyKey == "" {
+				return next(op)
+			}
+
+			ctx := context.Background()
+			if op.Request != nil {
+				ctx = op.Request.Context()
+			}
+
+			key := idempotencyStoreKey(op.Message)
+			if r, ok, err := d.store.Get(ctx, key); err != nil {
+				return err
+			} else if ok {
+				op.Result = r.clone()
+				return nil
+			}
+
+			for {
+				// Wait the send in progress of the key
+				d.mu.Lock()
+				if call, ok := d.inflight[key]; ok {
+					d.mu.Unlock()
+
+					select {
+					case <-call.done:
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+
+					if call.err == nil && call.result != nil {
+						op.Result = call.result.clone()
+						return nil
+					}
+
+					// The send failed, one of the waiters sends the message again
+					continue
+				}
+
+				// The leader may have saved the result and finished since the first Get
+				if r, ok, err := d.store.Get(ctx, key); err != nil || ok {
+					d.mu.Unlock()
+					if err != nil {
+						return err
+					}
+					op.Result = r.clone()
+					return nil
+				}
+
+				call := &inflightSend{done: make(chan struct{})}
+				d.inflight[key] = call
+				d.mu.Unlock()
+
+				call.err = next(op)
+				if call.err == nil {
+					if r, ok := op.Result.(*Response); ok {
+						call.result = r.clone()
+
+						// The message was sent, an error saving the result must not make the caller send it again
+						_ = d.store.Set(ctx, key, call.result, d.window)
+					}
+				}
+
+				d.mu.Lock()
+				delete(d.inflight, key)
+				d.mu.Unlock()
+				close(call.done)
+
+				return call.err
+			}
+		}
+	}
+}
+
+// idempotencyStoreKey return the key of the message in the store, the key of the message is scoped
+// by the recipients so the batches of a message are not deduplicated between them
+func idempotencyStoreKey(m *message) string {
+	h := sha256.New()
+	h.Write([]byte(m.To))
+	h.Write([]byte{0})
+	h.Write([]byte(m.Condition))
+	for _, id := range m.RegistrationIds {
+		h.Write([]byte{0})
+		h.Write([]byte(id))
+	}
+
+	return m.idempotencyKey + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// MemoryStore IdempotencyStore in memory that evict the least recently used keys
+type MemoryStore struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+
+	// now is replaced by tests
+	now func() time.Time
+}
+
+type memoryEntry struct {
+	key       string
+	result    *Response
+	expiresAt time.Time
+}
+
+// NewMemoryStore create a MemoryStore of at most size keys
+func NewMemoryStore(size int) *MemoryStore {
+	if size <= 0 {
+		size = defaultIdempotencyStoreSize
+	}
+
+	return &MemoryStore{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+// Get return the result of key if it didn't expire
+func (s *MemoryStore) Get(ctx context.Context, key string) (*Response, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	entry := el.Value.(*memoryEntry)
+	if !s.now().Before(entry.expiresAt) {
+		s.lru.Remove(el)
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+
+	s.lru.MoveToFront(el)
+	return entry.result, true, nil
+}
+
+// Set save the result of key for ttl, evicting the least recently used key if the store is full
+func (s *MemoryStore) Set(ctx context.Context, key string, r *Response, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt := s.now().Add(ttl)
+	if el, ok := s.entries[key]; ok {
+		entry := el.Value.(*memoryEntry)
+		entry.result, entry.expiresAt = r, expiresAt
+		s.lru.MoveToFront(el)
+		return nil
+	}
+
+	s.entries[key] = s.lru.PushFront(&memoryEntry{key: key, result: r, expiresAt: expiresAt})
+
+	for s.lru.Len() > s.size {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryEntry).key)
+	}
+
+	return nil
+}
+
+// Len return the number of keys in the store
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lru.Len()
+}
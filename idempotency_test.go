@@ -0,0 +1,215 @@
+package fcm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeduplicator(t *testing.T) {
+	t.Parallel()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprintf(rw, `{"success": 1, "results": [{"message_id": "%d"}]}`, n)
+	}))
+	defer server.Close()
+
+	client := NewClient("key", WithEndpoints(Endpoints{FCM: server.URL}), WithDeduplicator(NewDeduplicator(nil, time.Minute)))
+	client.PushSingle("token 1", map[string]string{"msg": "hi"})
+	client.SetIdempotencyKey("order-1")
+
+	var wg sync.WaitGroup
+	results := make([]*Response, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			m := *client.Message
+			r, err := client.send(context.Background(), &m)
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = r
+		}(i)
+	}
+	wg.Wait()
+
+	for _, r := range results {
+		if r == nil || r.Results[0].MessageID != "1" {
+			t.Fatalf("expected original result, got %+v", r)
+		}
+	}
+
+	// Other recipients with the same key are sent
+	client.PushSingle("token 2", map[string]string{"msg": "hi"})
+	if r, _ := client.Send(); r.Results[0].MessageID != "2" {
+		t.Errorf("expected new result, got %+v", r)
+	}
+
+	// Messages without key are always sent
+	client.SetIdempotencyKey("")
+	client.Send()
+
+	if requests != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+}
+
+func TestDeduplicator_Error(t *testing.T) {
+	t.Parallel()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(rw, `{"success": 1, "results": [{"message_id": "1"}]}`)
+	}))
+	defer server.Close()
+
+	client := NewClient("key", WithEndpoints(Endpoints{FCM: server.URL}), WithDeduplicator(NewDeduplicator(nil, 0)))
+	client.PushSingle("token", map[string]string{"msg": "hi"})
+	client.SetIdempotencyKey("order-1")
+
+	if _, err := client.Send(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// A failed send is not remembered
+	if _, err := client.Send(); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+
+	// Concurrent sends wait for the first one, when it fails only one of them sends again
+	var concurrent int32
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&concurrent, 1) == 1 {
+			<-release
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(rw, `{"success": 1, "results": [{"message_id": "2"}]}`)
+	}))
+	defer slow.Close()
+
+	dedup := NewDeduplicator(nil, 0)
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		c := NewClient("key", WithEndpoints(Endpoints{FCM: slow.URL}), WithDeduplicator(dedup))
+		c.PushSingle("token", map[string]string{"msg": "hi"})
+		c.SetIdempotencyKey("order-2")
+
+		go func() {
+			_, err := c.Send()
+			errs <- err
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	var failed int
+	for i := 0; i < 5; i++ {
+		if err := <-errs; err != nil {
+			failed++
+		}
+	}
+
+	if failed != 1 || concurrent != 2 {
+		t.Errorf("expected 1 failed send and 2 requests, got %d and %d", failed, concurrent)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Unix(1500000000, 0)
+	store := NewMemoryStore(2)
+	store.now = func() time.Time { return now }
+
+	store.Set(ctx, "a", &Response{Success: 1}, time.Minute)
+	store.Set(ctx, "b", &Response{Success: 2}, time.Hour)
+
+	// Use a so b is the least recently used
+	if r, ok, _ := store.Get(ctx, "a"); !ok || r.Success != 1 {
+		t.Fatalf("expected a, got %+v %v", r, ok)
+	}
+
+	store.Set(ctx, "c", &Response{Success: 3}, time.Hour)
+	if _, ok, _ := store.Get(ctx, "b"); ok || store.Len() != 2 {
+		t.Errorf("expected b evicted, len %d", store.Len())
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok, _ := store.Get(ctx, "a"); ok {
+		t.Error("expected a expired")
+	}
+
+	if _, ok, _ := store.Get(ctx, "c"); !ok {
+		t.Error("expected c")
+	}
+}
+
+// hookStore call hook before the first Get return
+type hookStore struct {
+	IdempotencyStore
+	called int32
+	hook   func()
+}
+
+func (s *hookStore) Get(ctx context.Context, key string) (*Response, bool, error) {
+	r, ok, err := s.IdempotencyStore.Get(ctx, key)
+	if atomic.CompareAndSwapInt32(&s.called, 0, 1) {
+		s.hook()
+	}
+	return r, ok, err
+}
+
+func TestDeduplicator_SentAfterGet(t *testing.T) {
+	t.Parallel()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		fmt.Fprintf(rw, `{"success": 1, "results": [{"message_id": "%d"}]}`, n)
+	}))
+	defer server.Close()
+
+	store := &hookStore{IdempotencyStore: NewMemoryStore(10)}
+	client := NewClient("key", WithEndpoints(Endpoints{FCM: server.URL}), WithDeduplicator(NewDeduplicator(store, time.Minute)))
+	client.PushSingle("token 1", map[string]string{"msg": "hi"})
+	client.SetIdempotencyKey("order-1")
+
+	// Other send of the key completes between the first Get and the check of the sends in progress
+	store.hook = func() {
+		m := *client.Message
+		if _, err := client.send(context.Background(), &m); err != nil {
+			t.Error(err)
+		}
+	}
+
+	r, err := client.Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if requests != 1 || r.Results[0].MessageID != "1" {
+		t.Errorf("expected the message sent once, got %d requests and %+v", requests, r)
+	}
+}
@@ -0,0 +1,126 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// Default max size of images, FCM limits the images to 1MB
+	defaultMaxImageSize = 1 << 20
+)
+
+var (
+	// Errors
+	ErrInvalidImageURL = errors.New("image url must be a well-formed https url")
+)
+
+// ImageCheck check the image of the notification with a HEAD request before send the message
+type ImageCheck struct {
+	// MaxSize max size in bytes of the image, 1MB if zero
+	MaxSize int64
+	// ContentTypes permitted, any image/* content type if empty
+	ContentTypes []string
+}
+
+// ImageError error returned when the image of the notification fails the ImageCheck
+type ImageError struct {
+	URL    string
+	Reason string
+}
+
+func (e *ImageError) Error() string {
+	return fmt.Sprintf("image %s: %s", e.URL, e.Reason)
+}
+
+// SetImage set the image of the notification and the fields required to show it on iOS
+func (c *Client) SetImage(u string) error {
+	if err := validateImageURL(u); err != nil {
+		return err
+	}
+
+	if c.Message.Notification == nil {
+		c.Message.Notification = &NotificationPayload{}
+	}
+	c.Message.Notification.Image = u
+
+	// iOS needs mutable content to download the image in the notification service extension
+	c.Message.MutableContent = true
+
+	return nil
+}
+
+// SetImageCheck check the image of the notification before send, nil disable the check
+func (c *Client) SetImageCheck(ic *ImageCheck) {
+	c.imageCheck = ic
+}
+
+// checkImage check the image of url with a HEAD request
+func (c *Client) checkImage(ctx context.Context, u string) error {
+	ic := c.imageCheck
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, u, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.clientHttp.Do(request)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &ImageError{URL: u, Reason: fmt.Sprintf("statusCode: %d", resp.StatusCode)}
+	}
+
+	maxSize := ic.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxImageSize
+	}
+
+	if resp.ContentLength > maxSize {
+		return &ImageError{URL: u, Reason: fmt.Sprintf("size %d exceeds %d bytes", resp.ContentLength, maxSize)}
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.TrimSpace(contentType)
+
+	if !allowedContentType(contentType, ic.ContentTypes) {
+		return &ImageError{URL: u, Reason: fmt.Sprintf("content type %q not permitted", contentType)}
+	}
+
+	return nil
+}
+
+// allowedContentType return true if ct is in types or an image if types is empty
+func allowedContentType(ct string, types []string) bool {
+	if len(types) == 0 {
+		return strings.HasPrefix(ct, "image/")
+	}
+
+	for _, t := range types {
+		if t == ct {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateImageURL return error if u is not a well-formed https url
+func validateImageURL(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return ErrInvalidImageURL
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package fcm
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient_SetImage(t *testing.T) {
+	t.Parallel()
+
+	client := NewClient("key")
+	client.PushSingle("token", nil)
+
+	if err := client.SetImage("http://example.com/a.png"); !errors.Is(err, ErrInvalidImageURL) {
+		t.Errorf("expected ErrInvalidImageURL, got %v", err)
+	}
+
+	if err := client.SetImage("https:///a.png"); !errors.Is(err, ErrInvalidImageURL) {
+		t.Errorf("expected ErrInvalidImageURL, got %v", err)
+	}
+
+	if err := client.SetImage("https://example.com/a.png"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if client.Message.Notification.Image != "https://example.com/a.png" || !client.Message.MutableContent {
+		t.Errorf("unexpected message %+v", client.Message)
+	}
+
+	requests, err := client.Message.V1()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apns := requests[0].Message.Apns
+	if apns == nil || apns.FcmOptions == nil || apns.FcmOptions.Image != "https://example.com/a.png" {
+		t.Errorf("expected apns fcm_options image, got %+v", apns)
+	}
+}
+
+func TestClient_ImageCheck(t *testing.T) {
+	t.Parallel()
+
+	var sent bool
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/small.png":
+			rw.Header().Set("Content-Type", "image/png")
+			rw.Header().Set("Content-Length", "100")
+		case "/large.png":
+			rw.Header().Set("Content-Type", "image/png")
+			rw.Header().Set("Content-Length", "2000000")
+		case "/page.html":
+			rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		case "/fcm/send":
+			sent = true
+			rw.Header().Set("Content-Type", "application/json")
+			rw.Write([]byte(`{"success": 1, "results": [{"message_id": "1"}]}`))
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient("key")
+	client.SetHTTPClient(server.Client())
+	client.Endpoints.FCM = server.URL
+	client.SetImageCheck(&ImageCheck{})
+	client.PushSingle("token", nil)
+
+	for _, path := range []string{"/large.png", "/page.html", "/missing.png"} {
+		if err := client.SetImage(server.URL + path); err != nil {
+			t.Fatal(err)
+		}
+
+		var imageErr *ImageError
+		if _, err := client.Send(); !errors.As(err, &imageErr) {
+			t.Errorf("%s: expected ImageError, got %v", path, err)
+		}
+	}
+
+	if sent {
+		t.Error("expected message not sent")
+	}
+
+	if err := client.SetImage(server.URL + "/small.png"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Send(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if !sent {
+		t.Error("expected message sent")
+	}
+}
+
+func TestAllowedContentType(t *testing.T) {
+	t.Parallel()
+
+	if !allowedContentType("image/jpeg", nil) || allowedContentType("text/plain", nil) {
+		t.Error("expected any image permitted by default")
+	}
+
+	if allowedContentType("image/gif", []string{"image/png"}) || !allowedContentType("image/png", []string{"image/png"}) {
+		t.Error("expected only image/png permitted")
+	}
+}
@@ -0,0 +1,240 @@
+package fcm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Ways to redact tokens in logs
+	RedactHash     Redaction = iota // sha256 prefix of the token
+	RedactTruncate                  // first chars of the token
+	RedactNone                      // token as is
+
+	// Value of redacted secrets and data
+	redacted = "[REDACTED]"
+	// Chars kept of hashes and truncated tokens
+	redactKeep = 8
+)
+
+// Redaction way to redact tokens in logs
+type Redaction int
+
+// Token return t redacted
+func (r Redaction) Token(t string) string {
+	switch r {
+	case RedactNone:
+		return t
+	case RedactTruncate:
+		if len(t) <= redactKeep {
+			return t
+		}
+		return t[:redactKeep] + "..."
+	default:
+		sum := sha256.Sum256([]byte(t))
+		return "sha256:" + hex.EncodeToString(sum[:])[:2*redactKeep]
+	}
+}
+
+// LogConfig configure the records of the logger of the client, the zero value uses the defaults
+type LogConfig struct {
+	// RequestLevel level of the request records, default slog.LevelDebug if nil
+	RequestLevel slog.Leveler
+	// ResponseLevel level of the response records, default slog.LevelDebug if nil
+	ResponseLevel slog.Leveler
+	// ErrorLevel level of the records of failed operations, default slog.LevelError if nil
+	ErrorLevel slog.Leveler
+	// Bodies add the request and response bodies to the records
+	Bodies bool
+	// Tokens way to redact the registration tokens, default RedactHash
+	Tokens Redaction
+	// DataKeys keys of the data of the message whose values are redacted
+	DataKeys []string
+}
+
+// DefaultLogConfig return the default LogConfig
+func DefaultLogConfig() LogConfig {
+	return LogConfig{
+		RequestLevel:  slog.LevelDebug,
+		ResponseLevel: slog.LevelDebug,
+		ErrorLevel:    slog.LevelError,
+		Tokens:        RedactHash,
+	}
+}
+
+// SetLogger set the logger that record every request and response of the client,
+// tokens, credentials and data keys are redacted according to cfg. A nil logger disable the logs
+func (c *Client) SetLogger(l *slog.Logger, cfg LogConfig) {
+	c.logger = l
+	c.logConfig = cfg
+}
+
+// logMiddleware record the request and response of every attempt of an operation, it runs
+// after the middlewares of the client so the records show what is sent
+func (c *Client) logMiddleware(next Handler) Handler {
+	return func(op *Operation) error {
+		l, cfg := c.logger, c.logConfig
+		if l == nil {
+			return next(op)
+		}
+
+		ctx := op.Request.Context()
+		if level := levelOf(cfg.RequestLevel, slog.LevelDebug); l.Enabled(ctx, level) {
+			attrs := []slog.Attr{
+				slog.String("operation", op.Name),
+				slog.String("method", op.Request.Method),
+				slog.String("url", cfg.redactURL(op.Request.URL, op.Tokens)),
+				slog.Int("recipients", len(op.Tokens)),
+				slog.Any("headers", redactHeaders(op.Request.Header)),
+			}
+			if cfg.Bodies {
+				attrs = append(attrs, slog.String("body", cfg.redactBody(op.RequestBody)))
+			}
+			l.LogAttrs(ctx, level, "fcm request", attrs...)
+		}
+
+		start := time.Now()
+		err := next(op)
+
+		level := levelOf(cfg.ResponseLevel, slog.LevelDebug)
+		if err != nil {
+			level = levelOf(cfg.ErrorLevel, slog.LevelError)
+		}
+
+		if l.Enabled(ctx, level) {
+			attrs := []slog.Attr{
+				slog.String("operation", op.Name),
+				slog.Duration("duration", time.Since(start)),
+			}
+			if op.Response != nil {
+				attrs = append(attrs, slog.Int("status", op.Response.StatusCode))
+			}
+			if cfg.Bodies && op.ResponseBody != nil {
+				attrs = append(attrs, slog.String("body", cfg.redactBody(op.ResponseBody)))
+			}
+			if err != nil {
+				attrs = append(attrs, slog.String("error", err.Error()))
+			}
+			l.LogAttrs(ctx, level, "fcm response", attrs...)
+		}
+
+		return err
+	}
+}
+
+// levelOf return the level of l or d if l is nil
+func levelOf(l slog.Leveler, d slog.Level) slog.Level {
+	if l == nil {
+		return d
+	}
+
+	return l.Level()
+}
+
+// redactURL return u with the tokens redacted from its decoded path and query values
+func (cfg LogConfig) redactURL(u *url.URL, tokens []string) string {
+	if cfg.Tokens == RedactNone || len(tokens) == 0 {
+		return u.Redacted()
+	}
+
+	r := *u
+	r.RawPath = ""
+	q := r.Query()
+	for _, t := range tokens {
+		rt := cfg.Tokens.Token(t)
+		r.Path = strings.Replace(r.Path, t, rt, -1)
+		for _, vs := range q {
+			for i, v := range vs {
+				vs[i] = strings.Replace(v, t, rt, -1)
+			}
+		}
+	}
+	if r.RawQuery != "" {
+		r.RawQuery = q.Encode()
+	}
+
+	return r.Redacted()
+}
+
+// redactHeaders return the headers with the credentials redacted
+func redactHeaders(h http.Header) map[string]string {
+	hs := make(map[string]string, len(h))
+	for k := range h {
+		v := h.Get(k)
+		if k == "Authorization" {
+			// Keep the scheme, e.g. key= or Bearer
+			if i := strings.IndexAny(v, "= "); i >= 0 {
+				v = v[:i+1] + redacted
+			} else {
+				v = redacted
+			}
+		}
+		hs[k] = v
+	}
+
+	return hs
+}
+
+// redactBody return the JSON body b with tokens and data keys redacted
+func (cfg LogConfig) redactBody(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		// Not JSON, keep it out of the logs
+		return redacted
+	}
+
+	rb, err := json.Marshal(cfg.redactValue("", v))
+	if err != nil {
+		return redacted
+	}
+
+	return string(rb)
+}
+
+// redactValue redact the value v of key
+func (cfg LogConfig) redactValue(key string, v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, kv := range val {
+			if key == "data" && cfg.isDataKey(k) {
+				val[k] = redacted
+				continue
+			}
+			val[k] = cfg.redactValue(k, kv)
+		}
+	case []interface{}:
+		for i, iv := range val {
+			val[i] = cfg.redactValue(key, iv)
+		}
+	case string:
+		switch key {
+		case "to", "registration_ids", "registration_tokens", "registration_id", "token":
+			if !strings.HasPrefix(val, topicPrefix) {
+				return cfg.Tokens.Token(val)
+			}
+		}
+	}
+
+	return v
+}
+
+// isDataKey return true if the data key k must be redacted
+func (cfg LogConfig) isDataKey(k string) bool {
+	for _, dk := range cfg.DataKeys {
+		if dk == k {
+			return true
+		}
+	}
+
+	return false
+}
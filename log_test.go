@@ -0,0 +1,131 @@
+package fcm
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClient_SetLogger(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+		fmt.Fprint(rw, `{"success": 1, "results": [{"message_id":"1", "registration_id":"canonical-token-123"}]}`)
+	}))
+
+	defer server.Close()
+
+	var buf bytes.Buffer
+	cfg := DefaultLogConfig()
+	cfg.Bodies = true
+	cfg.DataKeys = []string{"secret"}
+
+	client := NewClient("api-key-123")
+	client.Endpoints.FCM = server.URL
+	client.SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})), cfg)
+	client.PushMultiple([]string{"device-token-123"}, map[string]string{"secret": "s3cr3t", "body": "Test"})
+
+	if _, err := client.Send(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	logs := buf.String()
+	for _, s := range []string{"api-key-123", "device-token-123", "canonical-token-123", "s3cr3t"} {
+		if strings.Contains(logs, s) {
+			t.Errorf("expected %s redacted in logs: %s", s, logs)
+		}
+	}
+
+	for _, s := range []string{"fcm request", "fcm response", RedactHash.Token("device-token-123"), "key=[REDACTED]", "Test"} {
+		if !strings.Contains(logs, s) {
+			t.Errorf("expected %s in logs: %s", s, logs)
+		}
+	}
+}
+
+func TestClient_SetLogger_ZeroConfig(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+		fmt.Fprint(rw, `{"success": 1, "results": [{"message_id":"1"}]}`)
+	}))
+
+	defer server.Close()
+
+	var buf bytes.Buffer
+	client := NewClient("api-key-123")
+	client.Endpoints.FCM = server.URL
+	client.SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)), LogConfig{})
+	client.PushSingle("device-token-123", map[string]string{"body": "Test"})
+
+	if _, err := client.Send(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("expected request and response records at debug level, got %s", buf.String())
+	}
+
+	client.Endpoints.FCM = "http://127.0.0.1:0"
+	if _, err := client.Send(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if logs := buf.String(); strings.Contains(logs, "fcm request") || !strings.Contains(logs, `"level":"ERROR"`) {
+		t.Errorf("expected only the error record at error level, got %s", logs)
+	}
+}
+
+func TestRedaction_Token(t *testing.T) {
+	t.Parallel()
+
+	token := "abcdefghijklmnop"
+
+	if r := RedactNone.Token(token); r != token {
+		t.Errorf("expected %s, got %s", token, r)
+	}
+
+	if r := RedactTruncate.Token(token); r != "abcdefgh..." {
+		t.Errorf("expected abcdefgh..., got %s", r)
+	}
+
+	if r := RedactHash.Token(token); !strings.HasPrefix(r, "sha256:") || strings.Contains(r, token) {
+		t.Errorf("expected hash, got %s", r)
+	}
+}
+
+func TestLogConfig_RedactURL(t *testing.T) {
+	t.Parallel()
+
+	e := DefaultEndpoints()
+	req, _ := http.NewRequest(GET, e.tokenInfoURL("device/token"), nil)
+
+	u := DefaultLogConfig().redactURL(req.URL, []string{"device/token"})
+	if strings.Contains(u, "device") {
+		t.Errorf("expected token redacted, got %s", u)
+	}
+}
+
+func TestLogConfig_RedactURLQuery(t *testing.T) {
+	t.Parallel()
+
+	client := NewClient("test")
+	client.ApiIID = "http://legacy.local/info"
+	token := "dXs9:APA91bHun4MxP5egoKMwt2KZFBaFUH-1RYqx"
+	req, _ := http.NewRequest(GET, client.tokenInfoURL(token), nil)
+
+	u := DefaultLogConfig().redactURL(req.URL, []string{token})
+	if strings.Contains(u, "dXs9") || strings.Contains(u, "APA91b") {
+		t.Errorf("expected token redacted, got %s", u)
+	}
+
+	if !strings.HasPrefix(u, "http://legacy.local/info?token=") {
+		t.Errorf("expected the token query kept, got %s", u)
+	}
+}
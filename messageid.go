@@ -0,0 +1,95 @@
+package fcm
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// MessageID id of a message returned by FCM, it is decoded from JSON numbers and strings
+// and keep the original form, e.g. 6129433214581290593, "0:1500415314455276%31bd1c96f9fd7ecd"
+// or "projects/x/messages/123"
+type MessageID string
+
+// String return the original form of the id
+func (id MessageID) String() string {
+	return string(id)
+}
+
+// Number return the numeric portion of the id, false if the id has not one
+func (id MessageID) Number() (int64, bool) {
+	s := string(id)
+
+	// The id of v1 is the last segment of the name of the message
+	if i := strings.LastIndexByte(s, '/'); i >= 0 {
+		s = s[i+1:]
+	}
+
+	// Ids of topics and tokens are "0:<id>%<hash>"
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		s = s[i+1:]
+	}
+	if i := strings.IndexByte(s, '%'); i >= 0 {
+		s = s[:i]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return n, true
+}
+
+// UnmarshalJSON decode the id from a JSON number or string
+func (id *MessageID) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if bytes.Equal(b, []byte("null")) {
+		*id = ""
+		return nil
+	}
+
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		*id = MessageID(s)
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return err
+	}
+	*id = MessageID(n)
+
+	return nil
+}
+
+// MarshalJSON encode the id as a JSON number when it is an integer in canonical form, e.g. 123,
+// otherwise as a string, e.g. "007" or "+5"
+func (id MessageID) MarshalJSON() ([]byte, error) {
+	if isCanonicalInteger(string(id)) {
+		return []byte(id), nil
+	}
+
+	return json.Marshal(string(id))
+}
+
+// isCanonicalInteger return true if s is an integer without sign or leading zeros, so it is
+// a valid JSON number that decodes back to s
+func isCanonicalInteger(s string) bool {
+	if s == "" || (s[0] == '0' && len(s) > 1) {
+		return false
+	}
+
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
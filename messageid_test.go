@@ -0,0 +1,79 @@
+package fcm
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMessageID_UnmarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	body := `{
+		"multicast_id": 6129433214581290593,
+		"message_id": "0:1500415314455276%31bd1c96f9fd7ecd",
+		"results": [{"message_id": "projects/x/messages/123"}, {"message_id": 42}, {"message_id": null}]
+	}`
+
+	var r Response
+	if err := json.Unmarshal([]byte(body), &r); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if r.MultiCastId != "6129433214581290593" {
+		t.Errorf("expected 6129433214581290593, got %s", r.MultiCastId)
+	}
+
+	if r.MsgId != "0:1500415314455276%31bd1c96f9fd7ecd" {
+		t.Errorf("expected original id, got %s", r.MsgId)
+	}
+
+	if r.Results[0].MessageID != "projects/x/messages/123" || r.Results[1].MessageID != "42" || r.Results[2].MessageID != "" {
+		t.Errorf("unexpected results %+v", r.Results)
+	}
+}
+
+func TestMessageID_Number(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		id MessageID
+		n  int64
+		ok bool
+	}{
+		{"6129433214581290593", 6129433214581290593, true},
+		{"0:1500415314455276%31bd1c96f9fd7ecd", 1500415314455276, true},
+		{"projects/x/messages/123", 123, true},
+		{"projects/x/messages/0:1500415314455276%31bd1c96f9fd7ecd", 1500415314455276, true},
+		{"k2d2e3r4", 0, false},
+		{"", 0, false},
+	}
+
+	for _, c := range cases {
+		n, ok := c.id.Number()
+		if n != c.n || ok != c.ok {
+			t.Errorf("%s: expected %d %v, got %d %v", c.id, c.n, c.ok, n, ok)
+		}
+	}
+}
+
+func TestMessageID_MarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	b, err := json.Marshal([]MessageID{"123", "0:15%ab", "007", "+5", "0", "-5", "18446744073709551616"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != `[123,"0:15%ab","007","+5",0,"-5",18446744073709551616]` {
+		t.Errorf("unexpected json %s", b)
+	}
+
+	var ids []MessageID
+	if err := json.Unmarshal(b, &ids); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids[2] != "007" || ids[3] != "+5" {
+		t.Errorf("expected original forms, got %v", ids)
+	}
+}
@@ -0,0 +1,70 @@
+package fcm
+
+import (
+	"net/http"
+)
+
+const (
+	// Operations
+	OpSend         = "send"
+	OpTokenDetails = "token_details"
+)
+
+// Operation a logical FCM operation executed through the middlewares
+type Operation struct {
+	// Name of the operation, OpSend or OpTokenDetails
+	Name string
+	// Message sent by OpSend
+	Message *message
+	// Tokens the operation is about
+	Tokens []string
+	// Attempt number of the requests sent by the operation, the request is sent again with
+	// the next credential when FCM reject the current one. It is set when next return
+	Attempt int
+
+	// Request to execute, a middleware can modify or replace it before call next. Every
+	// attempt send a copy of it with the Authorization header of its credential
+	Request *http.Request
+	// RequestBody copy of the body of Request
+	RequestBody []byte
+	// Response received, set when next return
+	Response *http.Response
+	// ResponseBody copy of the body of Response
+	ResponseBody []byte
+	// Result parsed from Response: *Response for OpSend and *TokenInfo for
+	// OpTokenDetails. A middleware can set it and skip next
+	Result interface{}
+}
+
+// Handler execute an operation
+type Handler func(op *Operation) error
+
+// Middleware wrap a Handler to run code before and after the operation is executed
+type Middleware func(next Handler) Handler
+
+// parseFunc decode the response of an operation
+type parseFunc func(resp *http.Response) (interface{}, error)
+
+// Use add middlewares to the client, middlewares run in the order they are added,
+// the first one added is the outermost
+func (c *Client) Use(mw ...Middleware) {
+	c.middlewares = append(c.middlewares, mw...)
+}
+
+// chain wrap h with the middlewares of the client, they run once per operation
+func (c *Client) chain(h Handler) Handler {
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		h = c.middlewares[i](h)
+	}
+
+	return h
+}
+
+// messageTokens return the tokens or topic a message is sent to
+func messageTokens(m *message) []string {
+	if m.To != "" {
+		return []string{m.To}
+	}
+
+	return m.RegistrationIds
+}
@@ -0,0 +1,95 @@
+package fcm
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestClient_Use(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Trace") != "abc" {
+			t.Errorf("expected X-Trace abc, got %s", req.Header.Get("X-Trace"))
+		}
+		rw.WriteHeader(http.StatusOK)
+		fmt.Fprint(rw, `{"success": 1, "results": [{"message_id":"1"}]}`)
+	}))
+
+	defer server.Close()
+
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(op *Operation) error {
+				calls = append(calls, name+" before")
+				op.Request.Header.Set("X-Trace", "abc")
+				err := next(op)
+				calls = append(calls, name+" after")
+				return err
+			}
+		}
+	}
+
+	var result *Response
+	var body []byte
+	client := NewClient("test")
+	client.Endpoints.FCM = server.URL
+	client.Use(trace("first"), trace("second"))
+	client.Use(func(next Handler) Handler {
+		return func(op *Operation) error {
+			if op.Name != OpSend {
+				t.Errorf("expected %s, got %s", OpSend, op.Name)
+			}
+			err := next(op)
+			result, _ = op.Result.(*Response)
+			body = op.ResponseBody
+			return err
+		}
+	})
+	client.PushSingle("token", map[string]string{"body": "Test"})
+
+	status, err := client.Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"first before", "second before", "second after", "first after"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected %v, got %v", expected, calls)
+	}
+
+	if result != status {
+		t.Errorf("expected middleware to see the result")
+	}
+
+	if len(body) == 0 {
+		t.Error("expected response body")
+	}
+}
+
+func TestClient_UseShortCircuit(t *testing.T) {
+	t.Parallel()
+
+	client := NewClient("test")
+	client.Endpoints.FCM = "http://127.0.0.1:0"
+	client.Use(func(next Handler) Handler {
+		return func(op *Operation) error {
+			op.Result = &Response{StatusCode: http.StatusOK, Success: 1}
+			return nil
+		}
+	})
+	client.PushSingle("token", map[string]string{"body": "Test"})
+
+	status, err := client.Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if status.Success != 1 {
+		t.Errorf("expected 1, got %d", status.Success)
+	}
+}
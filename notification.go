@@ -0,0 +1,285 @@
+package fcm
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Priorities of notifications on Android
+	NotificationPriorityMin     NotificationPriority = "PRIORITY_MIN"
+	NotificationPriorityLow     NotificationPriority = "PRIORITY_LOW"
+	NotificationPriorityDefault NotificationPriority = "PRIORITY_DEFAULT"
+	NotificationPriorityHigh    NotificationPriority = "PRIORITY_HIGH"
+	NotificationPriorityMax     NotificationPriority = "PRIORITY_MAX"
+
+	// Visibilities of notifications on Android
+	VisibilityPrivate Visibility = "PRIVATE"
+	VisibilityPublic  Visibility = "PUBLIC"
+	VisibilitySecret  Visibility = "SECRET"
+)
+
+var (
+	// Errors
+	ErrLocArgsWithoutKey           = errors.New("localization args without localization key")
+	ErrInvalidColor                = errors.New("color must be in #rrggbb format")
+	ErrInvalidNotificationPriority = errors.New("invalid notification priority")
+	ErrInvalidVisibility           = errors.New("invalid visibility")
+	ErrInvalidNotificationCount    = errors.New("notification count must not be negative")
+	ErrInvalidSoundVolume          = errors.New("sound volume must be between 0 and 1")
+
+	// Format of colors
+	colorRegexp = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+type NotificationPayload struct {
+	Title            string  `json:"title,omitempty"`
+	Body             string  `json:"body,omitempty"`
+	BodyLocKey       string  `json:"body_loc_key,omitempty"`
+	BodyLocArgs      LocArgs `json:"body_loc_args,omitempty"`
+	Icon             string  `json:"icon,omitempty"`
+	Tag              string  `json:"tag,omitempty"`
+	Sound            string  `json:"sound,omitempty"`
+	Badge            string  `json:"badge,omitempty"`
+	Color            string  `json:"color,omitempty"`
+	ClickAction      string  `json:"click_action,omitempty"`
+	TitleLocKey      string  `json:"title_loc_key,omitempty"`
+	TitleLocArgs     LocArgs `json:"title_loc_args,omitempty"`
+	AndroidChannelID string  `json:"android_channel_id,omitempty"`
+
+	// Image url of the image of the notification
+	Image string `json:"image,omitempty"`
+	// Subtitle of the notification on iOS
+	Subtitle string `json:"subtitle,omitempty"`
+
+	// Android fields
+	Ticker                string               `json:"ticker,omitempty"`
+	Sticky                bool                 `json:"sticky,omitempty"`
+	EventTime             *time.Time           `json:"event_time,omitempty"`
+	LocalOnly             bool                 `json:"local_only,omitempty"`
+	NotificationPriority  NotificationPriority `json:"notification_priority,omitempty"`
+	DefaultSound          bool                 `json:"default_sound,omitempty"`
+	DefaultVibrateTimings bool                 `json:"default_vibrate_timings,omitempty"`
+	VibrateTimings        []Duration           `json:"vibrate_timings,omitempty"`
+	Visibility            Visibility           `json:"visibility,omitempty"`
+	NotificationCount     *int                 `json:"notification_count,omitempty"`
+	LightSettings         *LightSettings       `json:"light_settings,omitempty"`
+
+	// CriticalSound sound of a critical alert on iOS, it is sent as the sound dictionary
+	CriticalSound *CriticalSound `json:"-"`
+}
+
+// NotificationPriority priority of a notification on Android
+type NotificationPriority string
+
+// Visibility of a notification on the lock screen of Android
+type Visibility string
+
+// LightSettings settings of the LED of the device on Android
+type LightSettings struct {
+	// Color in #rrggbb format
+	Color            string   `json:"color"`
+	LightOnDuration  Duration `json:"light_on_duration"`
+	LightOffDuration Duration `json:"light_off_duration"`
+}
+
+// CriticalSound sound dictionary of a critical alert on iOS
+type CriticalSound struct {
+	Critical bool
+	// Name of the sound file, "default" for the system sound
+	Name string
+	// Volume between 0 and 1
+	Volume float64
+}
+
+// criticalSound wire format of CriticalSound, APNs expects critical as 1 or 0
+type criticalSound struct {
+	Critical int     `json:"critical,omitempty"`
+	Name     string  `json:"name"`
+	Volume   float64 `json:"volume,omitempty"`
+}
+
+// MarshalJSON encode the sound dictionary
+func (cs CriticalSound) MarshalJSON() ([]byte, error) {
+	v := criticalSound{Name: cs.Name, Volume: cs.Volume}
+	if cs.Critical {
+		v.Critical = 1
+	}
+
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decode the sound dictionary
+func (cs *CriticalSound) UnmarshalJSON(b []byte) error {
+	var v criticalSound
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	*cs = CriticalSound{Critical: v.Critical != 0, Name: v.Name, Volume: v.Volume}
+
+	return nil
+}
+
+// MarshalJSON encode the notification, the sound is the critical sound dictionary if set
+func (n NotificationPayload) MarshalJSON() ([]byte, error) {
+	type payload NotificationPayload
+	v := struct {
+		payload
+		Sound interface{} `json:"sound,omitempty"`
+	}{payload: payload(n)}
+
+	if n.CriticalSound != nil {
+		v.Sound = n.CriticalSound
+	} else if n.Sound != "" {
+		v.Sound = n.Sound
+	}
+
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decode the notification, the sound can be a name or a critical sound dictionary
+func (n *NotificationPayload) UnmarshalJSON(b []byte) error {
+	type payload NotificationPayload
+	v := struct {
+		*payload
+		Sound json.RawMessage `json:"sound,omitempty"`
+	}{payload: (*payload)(n)}
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	if len(v.Sound) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(v.Sound, &n.Sound); err == nil {
+		return nil
+	}
+
+	n.CriticalSound = new(CriticalSound)
+	if err := json.Unmarshal(v.Sound, n.CriticalSound); err != nil {
+		return err
+	}
+	n.Sound = n.CriticalSound.Name
+
+	return nil
+}
+
+// validate return error if the notification is wrong
+func (n *NotificationPayload) validate() error {
+	// Args are the values of the format specifiers of the localized string
+	if len(n.BodyLocArgs) > 0 && n.BodyLocKey == "" {
+		return ErrLocArgsWithoutKey
+	}
+
+	if len(n.TitleLocArgs) > 0 && n.TitleLocKey == "" {
+		return ErrLocArgsWithoutKey
+	}
+
+	if n.Image != "" {
+		if err := validateImageURL(n.Image); err != nil {
+			return err
+		}
+	}
+
+	if n.Color != "" && !colorRegexp.MatchString(n.Color) {
+		return ErrInvalidColor
+	}
+
+	if n.LightSettings != nil && !colorRegexp.MatchString(n.LightSettings.Color) {
+		return ErrInvalidColor
+	}
+
+	switch n.NotificationPriority {
+	case "", NotificationPriorityMin, NotificationPriorityLow, NotificationPriorityDefault,
+		NotificationPriorityHigh, NotificationPriorityMax:
+	default:
+		return ErrInvalidNotificationPriority
+	}
+
+	switch n.Visibility {
+	case "", VisibilityPrivate, VisibilityPublic, VisibilitySecret:
+	default:
+		return ErrInvalidVisibility
+	}
+
+	if n.NotificationCount != nil && *n.NotificationCount < 0 {
+		return ErrInvalidNotificationCount
+	}
+
+	if n.CriticalSound != nil && (n.CriticalSound.Volume < 0 || n.CriticalSound.Volume > 1) {
+		return ErrInvalidSoundVolume
+	}
+
+	return nil
+}
+
+// LocArgs values of the format specifiers of a localized string, encoded as a JSON array
+type LocArgs []string
+
+// UnmarshalJSON decode an array of strings, a string with a JSON array or a single string
+func (la *LocArgs) UnmarshalJSON(b []byte) error {
+	var args []string
+	if err := json.Unmarshal(b, &args); err == nil {
+		*la = args
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	switch {
+	case s == "":
+		*la = nil
+	case json.Unmarshal([]byte(s), &args) == nil:
+		*la = args
+	default:
+		*la = LocArgs{s}
+	}
+
+	return nil
+}
+
+// Duration time.Duration encoded as seconds with the suffix s, e.g. "3.5s"
+type Duration time.Duration
+
+// String return the duration in seconds with the suffix s
+func (d Duration) String() string {
+	return strconv.FormatFloat(time.Duration(d).Seconds(), 'f', -1, 64) + "s"
+}
+
+// MarshalJSON encode the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON decode a duration encoded as a string
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+
+	return nil
+}
+
+// parseColor return the red, green and blue of a #rrggbb color between 0 and 1
+func parseColor(c string) (float64, float64, float64) {
+	v, _ := strconv.ParseUint(strings.TrimPrefix(c, "#"), 16, 32)
+
+	return float64(v>>16&0xff) / 255, float64(v>>8&0xff) / 255, float64(v&0xff) / 255
+}
@@ -0,0 +1,174 @@
+package fcm
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocArgs_UnmarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in  string
+		out LocArgs
+	}{
+		{`{"body_loc_args":["a","b"]}`, LocArgs{"a", "b"}},
+		{`{"body_loc_args":"[\"a\",\"b\"]"}`, LocArgs{"a", "b"}},
+		{`{"body_loc_args":"a"}`, LocArgs{"a"}},
+		{`{"body_loc_args":""}`, nil},
+	}
+
+	for _, tc := range tests {
+		var n NotificationPayload
+		if err := json.Unmarshal([]byte(tc.in), &n); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.in, err)
+		}
+
+		if !reflect.DeepEqual(n.BodyLocArgs, tc.out) {
+			t.Errorf("%s: expected %v, got %v", tc.in, tc.out, n.BodyLocArgs)
+		}
+	}
+}
+
+func TestNotificationPayload_MarshalLocArgs(t *testing.T) {
+	t.Parallel()
+
+	n := NotificationPayload{TitleLocKey: "title_key", TitleLocArgs: []string{"Ana"}}
+
+	b, err := json.Marshal(n)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `{"title_loc_key":"title_key","title_loc_args":["Ana"]}`
+	if string(b) != expected {
+		t.Errorf("expected %s, got %s", expected, b)
+	}
+}
+
+func TestClient_SendLocArgsWithoutKey(t *testing.T) {
+	t.Parallel()
+
+	client := NewClient("key")
+	client.PushSingleNotification("token", &NotificationPayload{BodyLocArgs: []string{"Ana"}})
+
+	if _, err := client.Send(); err != ErrLocArgsWithoutKey {
+		t.Errorf("expected ErrLocArgsWithoutKey, got %v", err)
+	}
+}
+
+func TestNotificationPayload_AndroidFields(t *testing.T) {
+	t.Parallel()
+
+	count := 2
+	eventTime := time.Date(2019, 5, 19, 10, 0, 0, 0, time.UTC)
+	n := &NotificationPayload{
+		Title:                "a title",
+		Image:                "https://example.com/a.png",
+		Sticky:               true,
+		EventTime:            &eventTime,
+		NotificationPriority: NotificationPriorityHigh,
+		VibrateTimings:       []Duration{Duration(200 * time.Millisecond), Duration(time.Second)},
+		Visibility:           VisibilityPublic,
+		NotificationCount:    &count,
+		LightSettings: &LightSettings{
+			Color:            "#ff0000",
+			LightOnDuration:  Duration(3500 * time.Millisecond),
+			LightOffDuration: Duration(time.Second),
+		},
+	}
+
+	b, err := json.Marshal(n)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, s := range []string{
+		`"image":"https://example.com/a.png"`,
+		`"event_time":"2019-05-19T10:00:00Z"`,
+		`"notification_priority":"PRIORITY_HIGH"`,
+		`"vibrate_timings":["0.2s","1s"]`,
+		`"light_settings":{"color":"#ff0000","light_on_duration":"3.5s","light_off_duration":"1s"}`,
+	} {
+		if !strings.Contains(string(b), s) {
+			t.Errorf("expected %s in %s", s, b)
+		}
+	}
+
+	var decoded NotificationPayload
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(&decoded, n) {
+		t.Errorf("expected %+v, got %+v", n, decoded)
+	}
+
+	client := NewClient("key")
+	client.PushSingleNotification("token", n)
+	requests, err := client.Message.V1()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	an := requests[0].Message.Android.Notification
+	if an.LightSettings.Color.Red != 1 || an.LightSettings.Color.Green != 0 {
+		t.Errorf("unexpected color %+v", an.LightSettings.Color)
+	}
+
+	if an.EventTime != "2019-05-19T10:00:00Z" || an.Image != n.Image {
+		t.Errorf("unexpected android notification %+v", an)
+	}
+}
+
+func TestNotificationPayload_CriticalSound(t *testing.T) {
+	t.Parallel()
+
+	n := NotificationPayload{CriticalSound: &CriticalSound{Critical: true, Name: "default", Volume: 0.5}}
+
+	b, err := json.Marshal(n)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `{"sound":{"critical":1,"name":"default","volume":0.5}}`
+	if string(b) != expected {
+		t.Errorf("expected %s, got %s", expected, b)
+	}
+
+	var decoded NotificationPayload
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if decoded.CriticalSound == nil || !decoded.CriticalSound.Critical {
+		t.Errorf("expected critical sound, got %+v", decoded)
+	}
+}
+
+func TestNotificationPayload_Validate(t *testing.T) {
+	t.Parallel()
+
+	count := -1
+	tests := []struct {
+		n   NotificationPayload
+		err error
+	}{
+		{NotificationPayload{Color: "red"}, ErrInvalidColor},
+		{NotificationPayload{LightSettings: &LightSettings{Color: "#ff00"}}, ErrInvalidColor},
+		{NotificationPayload{NotificationPriority: "URGENT"}, ErrInvalidNotificationPriority},
+		{NotificationPayload{Visibility: "HIDDEN"}, ErrInvalidVisibility},
+		{NotificationPayload{NotificationCount: &count}, ErrInvalidNotificationCount},
+		{NotificationPayload{CriticalSound: &CriticalSound{Volume: 2}}, ErrInvalidSoundVolume},
+		{NotificationPayload{Color: "#00FF7f"}, nil},
+	}
+
+	for _, tc := range tests {
+		if err := tc.n.validate(); err != tc.err {
+			t.Errorf("%+v: expected %v, got %v", tc.n, tc.err, err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package fcm
+
+import (
+	"errors"
+	"regexp"
+)
+
+var (
+	// Errors
+	ErrInvalidAnalyticsLabel = errors.New("analytics label must have 1 to 50 chars of [a-zA-Z0-9-_.~%]")
+
+	// Format of the analytics labels permit by FCM
+	analyticsLabelRegexp = regexp.MustCompile(`^[a-zA-Z0-9\-_.~%]{1,50}$`)
+)
+
+// FcmOptions options of FCM features of a message
+type FcmOptions struct {
+	// AnalyticsLabel label associated with the analytics data of the message
+	AnalyticsLabel string `json:"analytics_label,omitempty"`
+}
+
+// SetAnalyticsLabel set the analytics label of the message
+func (c *Client) SetAnalyticsLabel(label string) error {
+	if !analyticsLabelRegexp.MatchString(label) {
+		return ErrInvalidAnalyticsLabel
+	}
+
+	if c.Message.FcmOptions == nil {
+		c.Message.FcmOptions = &FcmOptions{}
+	}
+	c.Message.FcmOptions.AnalyticsLabel = label
+
+	return nil
+}
+
+// Validate return error if the options are wrong
+func (o *FcmOptions) Validate() error {
+	if o.AnalyticsLabel != "" && !analyticsLabelRegexp.MatchString(o.AnalyticsLabel) {
+		return ErrInvalidAnalyticsLabel
+	}
+
+	return nil
+}
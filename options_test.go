@@ -0,0 +1,48 @@
+package fcm
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestClient_SetAnalyticsLabel(t *testing.T) {
+	t.Parallel()
+
+	client := NewClient("key")
+	client.PushSingle("token", map[string]string{"body": "Test"})
+
+	if err := client.SetAnalyticsLabel("campaign_2019-05%7E"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, label := range []string{"", "with space", strings.Repeat("a", 51)} {
+		if err := client.SetAnalyticsLabel(label); err != ErrInvalidAnalyticsLabel {
+			t.Errorf("%q: expected ErrInvalidAnalyticsLabel, got %v", label, err)
+		}
+	}
+
+	client.Message.DeliveryReceiptRequested = true
+	b, err := json.Marshal(client.Message)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, s := range []string{`"fcm_options":{"analytics_label":"campaign_2019-05%7E"}`, `"delivery_receipt_requested":true`} {
+		if !strings.Contains(string(b), s) {
+			t.Errorf("expected %s in %s", s, b)
+		}
+	}
+}
+
+func TestClient_SendInvalidAnalyticsLabel(t *testing.T) {
+	t.Parallel()
+
+	client := NewClient("key")
+	client.PushSingle("token", map[string]string{"body": "Test"})
+	client.Message.FcmOptions = &FcmOptions{AnalyticsLabel: "not valid!"}
+
+	if _, err := client.Send(); err != ErrInvalidAnalyticsLabel {
+		t.Errorf("expected ErrInvalidAnalyticsLabel, got %v", err)
+	}
+}
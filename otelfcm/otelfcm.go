@@ -0,0 +1,199 @@
+// Package otelfcm instrument a go-fcm Client with OpenTelemetry tracing.
+//
+// A span is created for every logical operation of the client (send and token details) and
+// a child span for every HTTP attempt of the operation, the request is sent again with the
+// next credential when FCM reject the current one:
+//
+//	otelfcm.Instrument(client)
+//	status, err := client.SendContext(ctx)
+package otelfcm
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/douglasmakey/go-fcm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// Name of the instrumentation
+	instrumentationName = "github.com/douglasmakey/go-fcm/otelfcm"
+
+	// Attributes
+	OperationKey    = attribute.Key("fcm.operation")
+	TargetTypeKey   = attribute.Key("fcm.target.type")
+	RecipientsKey   = attribute.Key("fcm.recipients")
+	SuccessKey      = attribute.Key("fcm.success")
+	FailureKey      = attribute.Key("fcm.failure")
+	CanonicalIdsKey = attribute.Key("fcm.canonical_ids")
+	ErrorCodesKey   = attribute.Key("fcm.error_codes")
+	AttemptsKey     = attribute.Key("fcm.attempts")
+)
+
+// config of the instrumentation
+type config struct {
+	provider    trace.TracerProvider
+	propagators propagation.TextMapPropagator
+}
+
+// Option configure the instrumentation
+type Option func(*config)
+
+// WithTracerProvider set the TracerProvider, the global one is used by default
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		c.provider = tp
+	}
+}
+
+// WithPropagators set the propagators used to inject the trace context in the requests,
+// the global one is used by default
+func WithPropagators(p propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagators = p
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		provider:    otel.GetTracerProvider(),
+		propagators: otel.GetTextMapPropagator(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Instrument add the tracing middleware to client and wrap the transport of its HTTPClient
+func Instrument(client *fcm.Client, opts ...Option) {
+	hc := *client.HTTPClient()
+	hc.Transport = NewTransport(hc.Transport, opts...)
+	client.SetHTTPClient(&hc)
+	client.Use(NewMiddleware(opts...))
+}
+
+// NewMiddleware return a middleware that create a span per operation
+func NewMiddleware(opts ...Option) fcm.Middleware {
+	cfg := newConfig(opts)
+	tracer := cfg.provider.Tracer(instrumentationName)
+
+	return func(next fcm.Handler) fcm.Handler {
+		return func(op *fcm.Operation) error {
+			ctx, span := tracer.Start(op.Request.Context(), "fcm."+op.Name,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(operationAttributes(op)...),
+			)
+			defer span.End()
+
+			op.Request = op.Request.WithContext(ctx)
+
+			err := next(op)
+
+			span.SetAttributes(AttemptsKey.Int(op.Attempt))
+			span.SetAttributes(resultAttributes(op.Result)...)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+
+			return err
+		}
+	}
+}
+
+// NewTransport return a RoundTripper that create a span per HTTP request and inject
+// the trace context in the request headers, base is http.DefaultTransport if nil
+func NewTransport(base http.RoundTripper, opts ...Option) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	cfg := newConfig(opts)
+
+	return &transport{
+		base:        base,
+		tracer:      cfg.provider.Tracer(instrumentationName),
+		propagators: cfg.propagators,
+	}
+}
+
+type transport struct {
+	base        http.RoundTripper
+	tracer      trace.Tracer
+	propagators propagation.TextMapPropagator
+}
+
+// RoundTrip execute the request inside a span
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := t.tracer.Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.full", req.URL.Redacted()),
+		),
+	)
+	defer span.End()
+
+	req = req.Clone(ctx)
+	t.propagators.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// operationAttributes return the attributes known before execute the operation
+func operationAttributes(op *fcm.Operation) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		OperationKey.String(op.Name),
+		RecipientsKey.Int(len(op.Tokens)),
+	}
+
+	switch {
+	case op.Message != nil:
+		attrs = append(attrs, TargetTypeKey.String(op.Message.TargetType()))
+	default:
+		attrs = append(attrs, TargetTypeKey.String(fcm.TargetToken))
+	}
+
+	return attrs
+}
+
+// resultAttributes return the attributes of the result of an operation
+func resultAttributes(result interface{}) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	var errs []string
+
+	switch r := result.(type) {
+	case *fcm.Response:
+		attrs = append(attrs,
+			SuccessKey.Int(r.Success),
+			FailureKey.Int(r.Failure),
+			CanonicalIdsKey.Int(r.CanonicalIds),
+		)
+		errs = r.ErrorCodes()
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		attrs = append(attrs, ErrorCodesKey.StringSlice(errs))
+	}
+
+	return attrs
+}
@@ -0,0 +1,142 @@
+package otelfcm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/douglasmakey/go-fcm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestInstrument(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("traceparent") == "" {
+			t.Error("expected traceparent header")
+		}
+		rw.WriteHeader(http.StatusOK)
+		fmt.Fprint(rw, `{
+			"success": 1,
+			"failure": 1,
+			"canonical_ids": 1,
+			"results": [{"message_id":"1", "registration_id":"new"}, {"error":"NotRegistered"}]
+		}`)
+	}))
+
+	defer server.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	client := fcm.NewClient("test")
+	client.Endpoints.FCM = server.URL
+	Instrument(client, WithTracerProvider(provider), WithPropagators(propagation.TraceContext{}))
+	client.PushMultiple([]string{"token 1", "token 2"}, map[string]string{"body": "Test"})
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	if _, err := client.SendContext(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+
+	request, op := spans[0], spans[1]
+	if op.Name() != "fcm.send" {
+		t.Errorf("expected fcm.send, got %s", op.Name())
+	}
+
+	if op.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("expected operation span child of the caller span")
+	}
+
+	if request.Parent().SpanID() != op.SpanContext().SpanID() {
+		t.Error("expected request span child of the operation span")
+	}
+
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range op.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+
+	expected := map[attribute.Key]attribute.Value{
+		TargetTypeKey:   attribute.StringValue(fcm.TargetToken),
+		RecipientsKey:   attribute.IntValue(2),
+		SuccessKey:      attribute.IntValue(1),
+		FailureKey:      attribute.IntValue(1),
+		CanonicalIdsKey: attribute.IntValue(1),
+		AttemptsKey:     attribute.IntValue(1),
+		ErrorCodesKey:   attribute.StringSliceValue([]string{"NotRegistered"}),
+	}
+
+	for k, v := range expected {
+		if attrs[k] != v {
+			t.Errorf("%s: expected %v, got %v", k, v.Emit(), attrs[k].Emit())
+		}
+	}
+}
+
+func TestInstrument_Attempts(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "key=secondary" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(rw, `{"success": 1, "results": [{"message_id":"1"}]}`)
+	}))
+
+	defer server.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	client := fcm.NewClient("primary", fcm.WithCredentials(fcm.APIKey("primary"), fcm.APIKey("secondary")))
+	client.Endpoints.FCM = server.URL
+	Instrument(client, WithTracerProvider(provider))
+	client.PushGroup("notification key", map[string]string{"body": "Test"})
+
+	if _, err := client.Send(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+
+	op := spans[2]
+	if op.Name() != "fcm.send" {
+		t.Fatalf("expected fcm.send, got %s", op.Name())
+	}
+
+	for _, attempt := range spans[:2] {
+		if attempt.Parent().SpanID() != op.SpanContext().SpanID() {
+			t.Errorf("expected attempt span %s child of the operation span", attempt.Name())
+		}
+	}
+
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range op.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+
+	if attrs[AttemptsKey] != attribute.IntValue(2) {
+		t.Errorf("expected 2 attempts, got %v", attrs[AttemptsKey].Emit())
+	}
+
+	if attrs[TargetTypeKey] != attribute.StringValue(fcm.TargetGroup) {
+		t.Errorf("expected %s target, got %v", fcm.TargetGroup, attrs[TargetTypeKey].Emit())
+	}
+}
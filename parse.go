@@ -2,21 +2,20 @@ package fcm
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
 )
 
-func parseFcmResponse(resp *http.Response) (*response, error) {
+func parseFcmResponse(resp *http.Response) (*Response, error) {
 	// Defers
 	defer resp.Body.Close()
 
 	// Check statusCode from resp
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("statusCode: %d error: %s", resp.StatusCode, resp.Status)
+		return nil, newHTTPError(resp)
 	}
 
 	// Create response
-	response := new(response)
+	response := new(Response)
 	response.StatusCode = resp.StatusCode
 	response.RetryAfter = resp.Header.Get("Retry-After")
 
@@ -27,17 +26,29 @@ func parseFcmResponse(resp *http.Response) (*response, error) {
 	return response, nil
 }
 
-func parseTokenDetails(resp *http.Response) (*tokenDetails, error) {
+func parseTokenDetails(resp *http.Response) (*TokenInfo, error) {
 	// Defers
 	defer resp.Body.Close()
 
+	// Errors of service or credentials are not about the token
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError,
+		resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode == http.StatusUnauthorized,
+		resp.StatusCode == http.StatusForbidden:
+		return nil, newHTTPError(resp)
+	}
+
 	// Create tokenDetails and decode
 	tokenDetails := new(tokenDetails)
-	tokenDetails.StatusCode = resp.StatusCode
 	if err := json.NewDecoder(resp.Body).Decode(tokenDetails); err != nil {
 		return nil, err
 	}
 
-	return tokenDetails, nil
+	if tokenDetails.Error != "" {
+		return nil, newTokenError(resp.StatusCode, tokenDetails.Error)
+	}
+
+	return tokenDetails.toTokenInfo(resp.StatusCode), nil
 
 }
@@ -2,10 +2,12 @@ package fcm
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestParseFcmResponse(t *testing.T) {
@@ -90,4 +92,76 @@ func TestParseTokenDetails(t *testing.T) {
 		t.Errorf("expected 200, got %d", details.StatusCode)
 	}
 
+	if details.Platform != PlatformAndroid {
+		t.Errorf("expected ANDROID, got %s", details.Platform)
+	}
+
+	connectDate := time.Date(2015, 5, 12, 0, 0, 0, 0, time.UTC)
+	if !details.ConnectDate.Equal(connectDate) {
+		t.Errorf("expected %v, got %v", connectDate, details.ConnectDate)
+	}
+
+	if len(details.Topics) != 4 {
+		t.Fatalf("expected 4, got %d", len(details.Topics))
+	}
+
+	if details.Topics[0].Name != "topicname1" {
+		t.Errorf("expected topicname1, got %s", details.Topics[0].Name)
+	}
+
+	addDate := time.Date(2015, 7, 30, 0, 0, 0, 0, time.UTC)
+	if !details.Topics[0].AddDate.Equal(addDate) {
+		t.Errorf("expected %v, got %v", addDate, details.Topics[0].AddDate)
+	}
+
+}
+
+func TestParseTokenDetailsErrors(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Query().Get("token") {
+		case "invalid":
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(rw, `{"error":"InvalidToken"}`)
+		case "unknown":
+			rw.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(rw, `{"error":"No information found about this instance id."}`)
+		default:
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+
+	defer server.Close()
+
+	tests := []struct {
+		token string
+		err   error
+	}{
+		{"invalid", ErrInvalidToken},
+		{"unknown", ErrUnknownToken},
+	}
+
+	for _, tc := range tests {
+		res, err := http.Get(server.URL + fmt.Sprintf("?token=%s", tc.token))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		_, err = parseTokenDetails(res)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("expected %v, got %v", tc.err, err)
+		}
+	}
+
+	res, err := http.Get(server.URL + "?token=token1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = parseTokenDetails(res)
+	var te *TokenError
+	if err == nil || errors.As(err, &te) {
+		t.Errorf("expected status error, got %v", err)
+	}
 }
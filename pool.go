@@ -0,0 +1,264 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// Idle connections per host kept by the transport shared by the pool
+	poolMaxIdleConnsPerHost = 100
+)
+
+var (
+	// Errors
+	ErrTenantNotFound = errors.New("tenant not found")
+)
+
+// TenantConfig config of the client of a tenant
+type TenantConfig struct {
+	APIKey string
+	// Credentials primary and optional secondary credential of the tenant, they are used
+	// instead of APIKey when set
+	Credentials []Credential
+	// Endpoints of the tenant, the default endpoints are used if nil
+	Endpoints *Endpoints
+}
+
+// ConfigSource provide the config of the tenants
+type ConfigSource interface {
+	TenantConfig(ctx context.Context, tenantID string) (*TenantConfig, error)
+}
+
+// ConfigSourceFunc allow use an ordinary function as ConfigSource
+type ConfigSourceFunc func(ctx context.Context, tenantID string) (*TenantConfig, error)
+
+// TenantConfig call f(ctx, tenantID)
+func (f ConfigSourceFunc) TenantConfig(ctx context.Context, tenantID string) (*TenantConfig, error) {
+	return f(ctx, tenantID)
+}
+
+// StaticConfigSource ConfigSource with a fixed map of tenant id and config
+type StaticConfigSource map[string]TenantConfig
+
+// TenantConfig return the config of the tenant or ErrTenantNotFound
+func (s StaticConfigSource) TenantConfig(ctx context.Context, tenantID string) (*TenantConfig, error) {
+	cfg, ok := s[tenantID]
+	if !ok {
+		return nil, ErrTenantNotFound
+	}
+
+	return &cfg, nil
+}
+
+// Pool build the clients of several tenants (e.g. Firebase projects) from a ConfigSource,
+// the configs are loaded lazily, the client of every tenant is cached until its config
+// is reloaded, and all the clients share one HTTPClient
+type Pool struct {
+	source     ConfigSource
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	configs   map[string]*tenantEntry
+	ttl       time.Duration
+	configure []func(tenantID string, c *Client)
+}
+
+// tenantEntry config and client of a tenant, the caller that add the entry load it and the
+// other callers wait until ready is closed
+type tenantEntry struct {
+	ready    chan struct{}
+	config   *TenantConfig
+	client   *Client
+	err      error
+	loadedAt time.Time
+}
+
+// loaded return true if the entry is ready
+func (e *tenantEntry) loaded() bool {
+	select {
+	case <-e.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewPool create a pool of clients using source to load the config of the tenants
+func NewPool(source ConfigSource) *Pool {
+	transport := newTransport()
+	transport.MaxIdleConnsPerHost = poolMaxIdleConnsPerHost
+
+	return &Pool{
+		source:     source,
+		httpClient: &http.Client{Transport: transport},
+		configs:    make(map[string]*tenantEntry),
+	}
+}
+
+// SetHTTPClient set the HTTPClient shared by the clients, the cached clients are built again
+func (p *Pool) SetHTTPClient(client *http.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.httpClient = client
+	p.resetClients()
+}
+
+// SetConfigTTL reload the config of a tenant when it is older than ttl, zero keeps it until Reload
+func (p *Pool) SetConfigTTL(ttl time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.ttl = ttl
+}
+
+// Configure add fn to be called with every client built by the pool, e.g. to add middlewares,
+// the cached clients are built again
+func (p *Pool) Configure(fn func(tenantID string, c *Client)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.configure = append(p.configure, fn)
+	p.resetClients()
+}
+
+// Reload drop the cached config and client of the tenant, the next client is built with
+// the config loaded again from the source, e.g. after rotate its credentials. A config
+// being loaded when Reload is called is not cached
+func (p *Pool) Reload(tenantID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.configs, tenantID)
+}
+
+// ReloadAll drop the cached configs and clients of all the tenants
+func (p *Pool) ReloadAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.configs = make(map[string]*tenantEntry)
+}
+
+// Client return the client of the tenant, it is built once per config load and shared
+// by the callers, so its Message must not be set concurrently, use Send for that
+func (p *Pool) Client(ctx context.Context, tenantID string) (*Client, error) {
+	p.mu.Lock()
+	e, ok := p.configs[tenantID]
+	if !ok || (e.loaded() && (e.client == nil || p.expired(e))) {
+		next := &tenantEntry{ready: make(chan struct{})}
+		// The clients were reset, keep the config
+		if ok && e.config != nil && !p.expired(e) {
+			next.config, next.loadedAt = e.config, e.loadedAt
+		}
+		e = next
+		p.configs[tenantID] = e
+		p.mu.Unlock()
+
+		p.load(ctx, tenantID, e)
+	} else {
+		p.mu.Unlock()
+	}
+
+	select {
+	case <-e.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	return e.client, nil
+}
+
+// load load the config of the entry if it has none and build its client, the entry is dropped
+// if it fails
+func (p *Pool) load(ctx context.Context, tenantID string, e *tenantEntry) {
+	defer close(e.ready)
+
+	if e.config == nil {
+		cfg, err := p.source.TenantConfig(ctx, tenantID)
+		if err != nil {
+			e.err = fmt.Errorf("tenant %s: %w", tenantID, err)
+
+			p.mu.Lock()
+			if p.configs[tenantID] == e {
+				delete(p.configs, tenantID)
+			}
+			p.mu.Unlock()
+			return
+		}
+		e.config, e.loadedAt = cfg, time.Now()
+	}
+
+	e.client = p.build(tenantID, e.config)
+}
+
+// expired return true if the config of the loaded entry is older than the ttl, p.mu must be held
+func (p *Pool) expired(e *tenantEntry) bool {
+	return p.ttl > 0 && time.Since(e.loadedAt) >= p.ttl
+}
+
+// Send call build to set the message and send it with the client of the tenant, build
+// receives a client used only to set the message so concurrent sends do not share it
+func (p *Pool) Send(ctx context.Context, tenantID string, build func(c *Client)) (*Response, error) {
+	c, err := p.Client(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Client{Message: &message{}}
+	build(b)
+
+	return c.send(ctx, b.Message)
+}
+
+// build create the client of the tenant with cfg
+func (p *Pool) build(tenantID string, cfg *TenantConfig) *Client {
+	p.mu.Lock()
+	httpClient := p.httpClient
+	configure := p.configure
+	p.mu.Unlock()
+
+	c := NewClient(cfg.APIKey)
+	c.SetHTTPClient(httpClient)
+	if cfg.Endpoints != nil {
+		c.Endpoints = *cfg.Endpoints
+	}
+
+	switch len(cfg.Credentials) {
+	case 0:
+	case 1:
+		c.SetCredentials(cfg.Credentials[0], nil)
+	default:
+		c.SetCredentials(cfg.Credentials[0], cfg.Credentials[1])
+	}
+
+	for _, fn := range configure {
+		fn(tenantID, c)
+	}
+
+	return c
+}
+
+// resetClients drop the cached clients keeping the loaded configs, the entries being loaded
+// are dropped so their clients are not cached, p.mu must be held
+func (p *Pool) resetClients() {
+	for id, e := range p.configs {
+		if !e.loaded() {
+			delete(p.configs, id)
+			continue
+		}
+
+		ready := make(chan struct{})
+		close(ready)
+		p.configs[id] = &tenantEntry{ready: ready, config: e.config, loadedAt: e.loadedAt}
+	}
+}
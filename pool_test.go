@@ -0,0 +1,203 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPool_Send(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "key=key-b" {
+			t.Errorf("expected key=key-b, got %s", req.Header.Get("Authorization"))
+		}
+		rw.WriteHeader(http.StatusOK)
+		fmt.Fprint(rw, `{"success": 1, "results": [{"message_id":"1"}]}`)
+	}))
+
+	defer server.Close()
+
+	endpoints := Endpoints{FCM: server.URL}
+	pool := NewPool(StaticConfigSource{
+		"a": {APIKey: "key-a", Endpoints: &endpoints},
+		"b": {APIKey: "key-b", Endpoints: &endpoints},
+	})
+
+	var configured string
+	pool.Configure(func(tenantID string, c *Client) {
+		configured = tenantID
+	})
+
+	status, err := pool.Send(context.Background(), "b", func(c *Client) {
+		c.PushSingle("token", map[string]string{"body": "Test"})
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if status.Success != 1 {
+		t.Errorf("expected 1, got %d", status.Success)
+	}
+
+	if configured != "b" {
+		t.Errorf("expected b, got %s", configured)
+	}
+
+	if _, err := pool.Client(context.Background(), "c"); !errors.Is(err, ErrTenantNotFound) {
+		t.Errorf("expected ErrTenantNotFound, got %v", err)
+	}
+}
+
+func TestPool_Reload(t *testing.T) {
+	t.Parallel()
+
+	var loads int32
+	pool := NewPool(ConfigSourceFunc(func(ctx context.Context, tenantID string) (*TenantConfig, error) {
+		n := atomic.AddInt32(&loads, 1)
+		return &TenantConfig{APIKey: fmt.Sprintf("key-%d", n)}, nil
+	}))
+
+	first, _ := pool.Client(context.Background(), "a")
+	second, _ := pool.Client(context.Background(), "a")
+
+	if first != second {
+		t.Error("expected the cached client")
+	}
+
+	if first.credentials[0] != APIKey("key-1") {
+		t.Errorf("expected config key-1, got %v", first.credentials[0])
+	}
+
+	pool.Reload("a")
+
+	third, _ := pool.Client(context.Background(), "a")
+	if third == first {
+		t.Error("expected a new client after Reload")
+	}
+
+	if third.HTTPClient() != first.HTTPClient() {
+		t.Error("expected shared HTTPClient")
+	}
+
+	if third.credentials[0] != APIKey("key-2") {
+		t.Errorf("expected reloaded config key-2, got %v", third.credentials[0])
+	}
+
+	pool.Configure(func(tenantID string, c *Client) {})
+
+	fourth, _ := pool.Client(context.Background(), "a")
+	if fourth == third || fourth.credentials[0] != APIKey("key-2") {
+		t.Errorf("expected a new client with the cached config, got %v", fourth.credentials[0])
+	}
+
+	pool.SetConfigTTL(time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	fifth, _ := pool.Client(context.Background(), "a")
+	if fifth.credentials[0] != APIKey("key-3") {
+		t.Errorf("expected expired config reloaded, got %v", fifth.credentials[0])
+	}
+}
+
+func TestPool_ConcurrentClient(t *testing.T) {
+	t.Parallel()
+
+	var loads int32
+	release := make(chan struct{})
+	pool := NewPool(ConfigSourceFunc(func(ctx context.Context, tenantID string) (*TenantConfig, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return &TenantConfig{APIKey: "key"}, nil
+	}))
+
+	var wg sync.WaitGroup
+	clients := make([]*Client, 10)
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clients[i], _ = pool.Client(context.Background(), "a")
+		}(i)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for _, c := range clients {
+		if c == nil || c != clients[0] {
+			t.Fatal("expected one client shared by the concurrent callers")
+		}
+	}
+
+	if loads != 1 {
+		t.Errorf("expected 1 load, got %d", loads)
+	}
+}
+
+func TestPool_ReloadWhileLoading(t *testing.T) {
+	t.Parallel()
+
+	var loads int32
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	pool := NewPool(ConfigSourceFunc(func(ctx context.Context, tenantID string) (*TenantConfig, error) {
+		n := atomic.AddInt32(&loads, 1)
+		if n == 1 {
+			close(loading)
+			<-release
+		}
+		return &TenantConfig{APIKey: fmt.Sprintf("key-%d", n)}, nil
+	}))
+
+	done := make(chan *Client)
+	go func() {
+		c, _ := pool.Client(context.Background(), "a")
+		done <- c
+	}()
+
+	// The config loaded before the Reload must not be cached
+	<-loading
+	pool.Reload("a")
+	close(release)
+	stale := <-done
+
+	c, _ := pool.Client(context.Background(), "a")
+	if c == stale || c.credentials[0] != APIKey("key-2") {
+		t.Errorf("expected the config loaded again after Reload, got %v", c.credentials[0])
+	}
+}
+
+func TestPool_Credentials(t *testing.T) {
+	t.Parallel()
+
+	server := newUnauthorizedServer("key=secondary")
+	defer server.Close()
+
+	endpoints := Endpoints{FCM: server.URL}
+	pool := NewPool(StaticConfigSource{
+		"a": {Credentials: []Credential{APIKey("primary"), APIKey("secondary")}, Endpoints: &endpoints},
+	})
+
+	for i := 0; i < 2; i++ {
+		_, err := pool.Send(context.Background(), "a", func(c *Client) {
+			c.PushSingle("token", map[string]string{"body": "Test"})
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	c, _ := pool.Client(context.Background(), "a")
+	if i, _ := c.credential(); i != 1 {
+		t.Errorf("expected failover kept by the cached client, got credential %d", i)
+	}
+}
@@ -0,0 +1,207 @@
+// Package promfcm collect Prometheus metrics of a go-fcm Client.
+//
+//	collector := promfcm.NewCollector()
+//	prometheus.MustRegister(collector)
+//	collector.Instrument(client)
+package promfcm
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/douglasmakey/go-fcm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// Error label of operations that failed without a result
+	requestError = "request_error"
+)
+
+// config of the collector
+type config struct {
+	namespace   string
+	latency     []float64
+	payloadSize []float64
+}
+
+// Option configure the collector
+type Option func(*config)
+
+// WithNamespace set the namespace of the metrics
+func WithNamespace(ns string) Option {
+	return func(c *config) {
+		c.namespace = ns
+	}
+}
+
+// WithLatencyBuckets set the buckets in seconds of the request latency histogram
+func WithLatencyBuckets(b []float64) Option {
+	return func(c *config) {
+		c.latency = b
+	}
+}
+
+// WithPayloadSizeBuckets set the buckets in bytes of the payload size histogram
+func WithPayloadSizeBuckets(b []float64) Option {
+	return func(c *config) {
+		c.payloadSize = b
+	}
+}
+
+// Collector prometheus.Collector with the metrics of the operations of a client
+type Collector struct {
+	messages    *prometheus.CounterVec
+	recipients  *prometheus.CounterVec
+	failures    *prometheus.CounterVec
+	canonical   prometheus.Counter
+	retries     *prometheus.CounterVec
+	latency     *prometheus.HistogramVec
+	payloadSize *prometheus.HistogramVec
+}
+
+// NewCollector create a Collector, register it with a prometheus.Registerer to expose the metrics
+func NewCollector(opts ...Option) *Collector {
+	cfg := &config{
+		latency:     prometheus.DefBuckets,
+		payloadSize: prometheus.ExponentialBuckets(256, 2, 8),
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return &Collector{
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.namespace,
+			Subsystem: "fcm",
+			Name:      "messages_total",
+			Help:      "Number of messages sent successfully.",
+		}, []string{"target_type"}),
+		recipients: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.namespace,
+			Subsystem: "fcm",
+			Name:      "recipients_total",
+			Help:      "Number of recipients of the messages sent successfully.",
+		}, []string{"target_type"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.namespace,
+			Subsystem: "fcm",
+			Name:      "failures_total",
+			Help:      "Number of failures by operation and error code.",
+		}, []string{"operation", "error"}),
+		canonical: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: cfg.namespace,
+			Subsystem: "fcm",
+			Name:      "canonical_ids_total",
+			Help:      "Number of registration ids rewritten with a canonical id.",
+		}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.namespace,
+			Subsystem: "fcm",
+			Name:      "retries_total",
+			Help:      "Number of requests sent again after the first attempt of an operation.",
+		}, []string{"operation"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: cfg.namespace,
+			Subsystem: "fcm",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of the operations.",
+			Buckets:   cfg.latency,
+		}, []string{"operation", "status"}),
+		payloadSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: cfg.namespace,
+			Subsystem: "fcm",
+			Name:      "payload_size_bytes",
+			Help:      "Size of the request payloads.",
+			Buckets:   cfg.payloadSize,
+		}, []string{"operation"}),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.messages.Describe(ch)
+	c.recipients.Describe(ch)
+	c.failures.Describe(ch)
+	c.canonical.Describe(ch)
+	c.retries.Describe(ch)
+	c.latency.Describe(ch)
+	c.payloadSize.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.messages.Collect(ch)
+	c.recipients.Collect(ch)
+	c.failures.Collect(ch)
+	c.canonical.Collect(ch)
+	c.retries.Collect(ch)
+	c.latency.Collect(ch)
+	c.payloadSize.Collect(ch)
+}
+
+// Instrument add the middleware of the collector to client
+func (c *Collector) Instrument(client *fcm.Client) {
+	client.Use(c.Middleware())
+}
+
+// Middleware return a middleware that record the metrics of every operation
+func (c *Collector) Middleware() fcm.Middleware {
+	return func(next fcm.Handler) fcm.Handler {
+		return func(op *fcm.Operation) error {
+			c.payloadSize.WithLabelValues(op.Name).Observe(float64(len(op.RequestBody)))
+
+			start := time.Now()
+			err := next(op)
+			c.latency.WithLabelValues(op.Name, status(op, err)).Observe(time.Since(start).Seconds())
+
+			if op.Attempt > 1 {
+				c.retries.WithLabelValues(op.Name).Inc()
+			}
+
+			if op.Message != nil && err == nil {
+				target := op.Message.TargetType()
+				c.messages.WithLabelValues(target).Inc()
+				c.recipients.WithLabelValues(target).Add(float64(len(op.Tokens)))
+			}
+
+			c.observeResult(op, err)
+
+			return err
+		}
+	}
+}
+
+// observeResult count the failures and canonical ids of the result of op
+func (c *Collector) observeResult(op *fcm.Operation, err error) {
+	switch r := op.Result.(type) {
+	case *fcm.Response:
+		c.canonical.Add(float64(r.CanonicalIds))
+		if r.Err != "" {
+			c.failures.WithLabelValues(op.Name, r.Err).Inc()
+		}
+		for _, val := range r.Results {
+			if val.Error != "" {
+				c.failures.WithLabelValues(op.Name, val.Error).Inc()
+			}
+		}
+		return
+	}
+
+	if err != nil {
+		c.failures.WithLabelValues(op.Name, requestError).Inc()
+	}
+}
+
+// status return the status label of op
+func status(op *fcm.Operation, err error) string {
+	if op.Response != nil {
+		return strconv.Itoa(op.Response.StatusCode)
+	}
+
+	if err != nil {
+		return "error"
+	}
+
+	return ""
+}
@@ -0,0 +1,129 @@
+package promfcm
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/douglasmakey/go-fcm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+		fmt.Fprint(rw, `{
+			"success": 1,
+			"failure": 2,
+			"canonical_ids": 1,
+			"results": [
+				{"message_id":"1", "registration_id":"new"},
+				{"error":"NotRegistered"},
+				{"error":"NotRegistered"}
+			]
+		}`)
+	}))
+
+	defer server.Close()
+
+	collector := NewCollector(WithNamespace("test"))
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+
+	client := fcm.NewClient("test")
+	client.Endpoints.FCM = server.URL
+	collector.Instrument(client)
+	client.PushMultiple([]string{"token 1", "token 2", "token 3"}, map[string]string{"body": "Test"})
+
+	if _, err := client.Send(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if v := testutil.ToFloat64(collector.messages.WithLabelValues(fcm.TargetToken)); v != 1 {
+		t.Errorf("expected 1 message, got %v", v)
+	}
+
+	if v := testutil.ToFloat64(collector.recipients.WithLabelValues(fcm.TargetToken)); v != 3 {
+		t.Errorf("expected 3 recipients, got %v", v)
+	}
+
+	if v := testutil.ToFloat64(collector.failures.WithLabelValues(fcm.OpSend, "NotRegistered")); v != 2 {
+		t.Errorf("expected 2 failures, got %v", v)
+	}
+
+	if v := testutil.ToFloat64(collector.canonical); v != 1 {
+		t.Errorf("expected 1 canonical id, got %v", v)
+	}
+
+	if n := testutil.CollectAndCount(collector, "test_fcm_request_duration_seconds"); n != 1 {
+		t.Errorf("expected 1 latency series, got %d", n)
+	}
+
+	if n := testutil.CollectAndCount(collector, "test_fcm_payload_size_bytes"); n != 1 {
+		t.Errorf("expected 1 payload size series, got %d", n)
+	}
+
+	if n := testutil.CollectAndCount(collector, "test_fcm_retries_total"); n != 0 {
+		t.Errorf("expected no retries, got %d", n)
+	}
+}
+
+func TestCollector_RequestError(t *testing.T) {
+	t.Parallel()
+
+	collector := NewCollector()
+
+	client := fcm.NewClient("test")
+	client.Endpoints.FCM = "http://127.0.0.1:0"
+	collector.Instrument(client)
+	client.PushSingle("token 1", map[string]string{"body": "Test"})
+
+	if _, err := client.Send(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if v := testutil.ToFloat64(collector.failures.WithLabelValues(fcm.OpSend, requestError)); v != 1 {
+		t.Errorf("expected 1 failure, got %v", v)
+	}
+
+	if n := testutil.CollectAndCount(collector, "fcm_messages_total"); n != 0 {
+		t.Errorf("expected no messages counted, got %d", n)
+	}
+}
+
+func TestCollector_Retries(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "key=secondary" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(rw, `{"success": 1, "results": [{"message_id":"1"}]}`)
+	}))
+
+	defer server.Close()
+
+	collector := NewCollector()
+
+	client := fcm.NewClient("primary", fcm.WithCredentials(fcm.APIKey("primary"), fcm.APIKey("secondary")))
+	client.Endpoints.FCM = server.URL
+	collector.Instrument(client)
+	client.PushSingle("token 1", map[string]string{"body": "Test"})
+
+	if _, err := client.Send(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if v := testutil.ToFloat64(collector.retries.WithLabelValues(fcm.OpSend)); v != 1 {
+		t.Errorf("expected 1 retry, got %v", v)
+	}
+
+	if v := testutil.ToFloat64(collector.messages.WithLabelValues(fcm.TargetToken)); v != 1 {
+		t.Errorf("expected 1 message, got %v", v)
+	}
+}
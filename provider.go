@@ -0,0 +1,181 @@
+package fcm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Default interval to check if a credential file changed
+	defaultWatchInterval = 10 * time.Second
+)
+
+var (
+	// Errors
+	ErrEmptyCredential = errors.New("credential is empty")
+)
+
+// StaticCredential return the Credential of value, an API key or the JSON key of a service account
+func StaticCredential(value string) (Credential, error) {
+	return parseCredential([]byte(value))
+}
+
+// parseCredential return a ServiceAccount if b is a JSON key or an APIKey
+func parseCredential(b []byte) (Credential, error) {
+	b = bytes.TrimSpace(b)
+	switch {
+	case len(b) == 0:
+		return nil, ErrEmptyCredential
+	case b[0] == '{':
+		return NewServiceAccount(b)
+	default:
+		return APIKey(b), nil
+	}
+}
+
+// EnvCredential Credential read from the environment variable with the name on every request, the
+// variable can contain an API key or the JSON key of a service account
+type EnvCredential string
+
+// envCredential credential parsed from the value of a variable
+type envCredential struct {
+	value      string
+	credential Credential
+}
+
+// Parsed credentials of the variables, kept while the value doesn't change to reuse the access tokens
+var envCredentials sync.Map
+
+// Authorization return the header of the credential in the variable
+func (e EnvCredential) Authorization(ctx context.Context, c *Client) (string, error) {
+	value := os.Getenv(string(e))
+
+	if v, ok := envCredentials.Load(e); ok && v.(*envCredential).value == value {
+		return v.(*envCredential).credential.Authorization(ctx, c)
+	}
+
+	credential, err := parseCredential([]byte(value))
+	if err != nil {
+		return "", fmt.Errorf("env %s: %w", string(e), err)
+	}
+	envCredentials.Store(e, &envCredential{value: value, credential: credential})
+
+	return credential.Authorization(ctx, c)
+}
+
+// FileCredential Credential read from a file that is polled for changes, the new content replace the
+// credential atomically so rotated secrets are used without restarting. The file can contain an API key
+// or the JSON key of a service account
+type FileCredential struct {
+	path       string
+	credential atomic.Pointer[Credential]
+
+	mu       sync.Mutex
+	modTime  time.Time
+	size     int64
+	onReload func(err error)
+
+	done chan struct{}
+	once sync.Once
+}
+
+// WatchFile load the credential of the file at path and check every interval if it changed,
+// 10s if interval is zero
+func WatchFile(path string, interval time.Duration) (*FileCredential, error) {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+
+	f := &FileCredential{path: path, done: make(chan struct{})}
+	if _, err := f.reload(); err != nil {
+		return nil, err
+	}
+
+	go f.watch(interval)
+
+	return f, nil
+}
+
+// Authorization return the header of the current credential of the file
+func (f *FileCredential) Authorization(ctx context.Context, c *Client) (string, error) {
+	return (*f.credential.Load()).Authorization(ctx, c)
+}
+
+// OnReload call fn after every reload of the file with the error of the reload, the previous
+// credential is kept if the new content is invalid
+func (f *FileCredential) OnReload(fn func(err error)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.onReload = fn
+}
+
+// Close stop watching the file
+func (f *FileCredential) Close() error {
+	f.once.Do(func() { close(f.done) })
+	return nil
+}
+
+// watch reload the file every interval until Close
+func (f *FileCredential) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+			reloaded, err := f.reload()
+			if !reloaded {
+				continue
+			}
+
+			f.mu.Lock()
+			fn := f.onReload
+			f.mu.Unlock()
+
+			if fn != nil {
+				fn(err)
+			}
+		}
+	}
+}
+
+// reload read the file if it changed and return true if it was read
+func (f *FileCredential) reload() (bool, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return true, err
+	}
+
+	f.mu.Lock()
+	changed := !info.ModTime().Equal(f.modTime) || info.Size() != f.size
+	f.mu.Unlock()
+	if !changed {
+		return false, nil
+	}
+
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return true, err
+	}
+
+	f.mu.Lock()
+	f.modTime, f.size = info.ModTime(), info.Size()
+	f.mu.Unlock()
+
+	credential, err := parseCredential(b)
+	if err != nil {
+		return true, fmt.Errorf("file %s: %w", f.path, err)
+	}
+	f.credential.Store(&credential)
+
+	return true, nil
+}
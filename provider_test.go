@@ -0,0 +1,108 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStaticCredential(t *testing.T) {
+	t.Parallel()
+
+	c, err := StaticCredential(" key\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c != APIKey("key") {
+		t.Errorf("expected APIKey, got %v", c)
+	}
+
+	if _, err := StaticCredential(""); !errors.Is(err, ErrEmptyCredential) {
+		t.Errorf("expected ErrEmptyCredential, got %v", err)
+	}
+
+	if _, err := StaticCredential(`{"private_key": ""}`); !errors.Is(err, ErrInvalidPrivateKey) {
+		t.Errorf("expected ErrInvalidPrivateKey, got %v", err)
+	}
+}
+
+func TestEnvCredential(t *testing.T) {
+	t.Setenv("GO_FCM_TEST_KEY", "first")
+
+	client := NewClient("")
+	credential := EnvCredential("GO_FCM_TEST_KEY")
+
+	if auth, err := credential.Authorization(context.Background(), client); err != nil || auth != "key=first" {
+		t.Errorf("expected key=first, got %s %v", auth, err)
+	}
+
+	os.Setenv("GO_FCM_TEST_KEY", "second")
+	if auth, err := credential.Authorization(context.Background(), client); err != nil || auth != "key=second" {
+		t.Errorf("expected key=second, got %s %v", auth, err)
+	}
+
+	os.Unsetenv("GO_FCM_TEST_KEY")
+	if _, err := credential.Authorization(context.Background(), client); !errors.Is(err, ErrEmptyCredential) {
+		t.Errorf("expected ErrEmptyCredential, got %v", err)
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, []byte("first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := WatchFile(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	reloads := make(chan error, 10)
+	f.OnReload(func(err error) { reloads <- err })
+
+	client := NewClient("")
+	if auth, _ := f.Authorization(context.Background(), client); auth != "key=first" {
+		t.Errorf("expected key=first, got %s", auth)
+	}
+
+	// Replace the file atomically as secret managers do
+	tmp := path + ".tmp"
+	os.WriteFile(tmp, []byte("second-key\n"), 0600)
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-reloads; err != nil {
+		t.Fatalf("unexpected reload error %v", err)
+	}
+
+	if auth, _ := f.Authorization(context.Background(), client); auth != "key=second-key" {
+		t.Errorf("expected key=second-key, got %s", auth)
+	}
+
+	// An invalid content keep the previous credential
+	os.WriteFile(path, []byte("  \n\n"), 0600)
+	if err := <-reloads; !errors.Is(err, ErrEmptyCredential) {
+		t.Fatalf("expected ErrEmptyCredential, got %v", err)
+	}
+
+	if auth, _ := f.Authorization(context.Background(), client); auth != "key=second-key" {
+		t.Errorf("expected key=second-key, got %s", auth)
+	}
+}
+
+func TestWatchFile_Missing(t *testing.T) {
+	t.Parallel()
+
+	if _, err := WatchFile(filepath.Join(t.TempDir(), "missing"), 0); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected ErrNotExist, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package fcm
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	// Status of a delivered message
+	StatusSentToDevice = "MESSAGE_SENT_TO_DEVICE"
+)
+
+// Receipt delivery receipt of a message
+type Receipt struct {
+	// MessageID id of the receipt
+	MessageID string
+	// OriginalMessageID id of the message delivered
+	OriginalMessageID string
+	Status            string
+	DeviceToken       string
+	// SentAt time the message was sent to the device
+	SentAt   time.Time
+	Category string
+	Data     map[string]string
+}
+
+// ReceiptHandler handle the delivery receipts received by a connection
+type ReceiptHandler interface {
+	HandleReceipt(r Receipt)
+}
+
+// ReceiptHandlerFunc allow use an ordinary function as ReceiptHandler
+type ReceiptHandlerFunc func(r Receipt)
+
+// HandleReceipt call f(r)
+func (f ReceiptHandlerFunc) HandleReceipt(r Receipt) {
+	f(r)
+}
+
+// NewReceipt create a Receipt from the data of a receipt message
+func NewReceipt(messageID, category string, data map[string]string) Receipt {
+	r := Receipt{
+		MessageID:         messageID,
+		OriginalMessageID: data["original_message_id"],
+		Status:            data["message_status"],
+		DeviceToken:       data["device_registration_id"],
+		Category:          category,
+		Data:              data,
+	}
+
+	if ms, err := strconv.ParseInt(data["message_sent_timestamp"], 10, 64); err == nil {
+		r.SentAt = time.Unix(0, ms*int64(time.Millisecond))
+	}
+
+	return r
+}
+
+// Delivered return true if the message was sent to the device
+func (r Receipt) Delivered() bool {
+	return r.Status == StatusSentToDevice
+}
@@ -0,0 +1,28 @@
+package fcm
+
+import (
+	"testing"
+)
+
+func TestNewReceipt(t *testing.T) {
+	t.Parallel()
+
+	r := NewReceipt("dr2:m-1", "com.example", map[string]string{
+		"message_status":         "MESSAGE_SENT_TO_DEVICE",
+		"original_message_id":    "m-1",
+		"device_registration_id": "token",
+		"message_sent_timestamp": "1486995556000",
+	})
+
+	if !r.Delivered() {
+		t.Error("expected delivered receipt")
+	}
+
+	if r.OriginalMessageID != "m-1" || r.DeviceToken != "token" {
+		t.Errorf("unexpected receipt %+v", r)
+	}
+
+	if r.SentAt.Unix() != 1486995556 {
+		t.Errorf("expected 1486995556, got %d", r.SentAt.Unix())
+	}
+}
@@ -1,26 +1,36 @@
 package fcm
 
-type response struct {
+// Response response of FCM to a message
+type Response struct {
 	StatusCode          int
-	Err                 string   `json:"error,omitempty"`
-	Success             int      `json:"success"`
-	MultiCastId         int64    `json:"multicast_id"`
-	CanonicalIds        int      `json:"canonical_ids"`
-	Failure             int      `json:"failure"`
-	Results             []result `json:"results,omitempty"`
-	MsgId               int64    `json:"message_id,omitempty"`
-	RetryAfter          string   `json:"retry_after"`
+	Err                 string    `json:"error,omitempty"`
+	Success             int       `json:"success"`
+	MultiCastId         MessageID `json:"multicast_id"`
+	CanonicalIds        int       `json:"canonical_ids"`
+	Failure             int       `json:"failure"`
+	Results             []Result  `json:"results,omitempty"`
+	MsgId               MessageID `json:"message_id,omitempty"`
+	RetryAfter          string    `json:"retry_after"`
 	copyRegistrationIds []string
 }
 
-type result struct {
-	MessageID      string `json:"message_id"`
-	RegistrationID string `json:"registration_id"`
-	Error          string `json:"error"`
+// Result result of the message for a registration id
+type Result struct {
+	MessageID      MessageID `json:"message_id"`
+	RegistrationID string    `json:"registration_id"`
+	Error          string    `json:"error"`
+}
+
+// clone return a copy of the response
+func (r *Response) clone() *Response {
+	c := *r
+	c.Results = append([]Result(nil), r.Results...)
+
+	return &c
 }
 
 // GetInvalidTokens return list with tokens wrongs
-func (r *response) GetInvalidTokens() map[string]string {
+func (r *Response) GetInvalidTokens() map[string]string {
 	tr := make(map[string]string)
 	for index, val := range r.Results {
 		if val.Error != "" {
@@ -30,3 +40,27 @@ func (r *response) GetInvalidTokens() map[string]string {
 
 	return tr
 }
+
+// ErrorCodes return the distinct errors of the results
+func (r *Response) ErrorCodes() []string {
+	return errorCodes(r.Err, r.Results)
+}
+
+// errorCodes return the distinct non empty errors of err and results
+func errorCodes(err string, results []Result) []string {
+	var codes []string
+	seen := make(map[string]bool)
+	if err != "" {
+		codes = append(codes, err)
+		seen[err] = true
+	}
+
+	for _, val := range results {
+		if val.Error != "" && !seen[val.Error] {
+			codes = append(codes, val.Error)
+			seen[val.Error] = true
+		}
+	}
+
+	return codes
+}
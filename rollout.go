@@ -0,0 +1,383 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const (
+	// Number of buckets of the recipients of a rollout, a bucket is 0.01%
+	rolloutBuckets = 10000
+)
+
+var (
+	// Errors
+	ErrRolloutAborted    = errors.New("rollout aborted")
+	ErrRolloutNotStopped = errors.New("rollout is not halted or aborted")
+	ErrRolloutStarted    = errors.New("rollout already started")
+)
+
+// RolloutState state of a Rollout
+type RolloutState int
+
+// States
+const (
+	RolloutPending RolloutState = iota
+	RolloutRunning
+	RolloutPaused
+	RolloutHalted
+	RolloutAborted
+	RolloutDone
+)
+
+func (s RolloutState) String() string {
+	switch s {
+	case RolloutPending:
+		return "pending"
+	case RolloutRunning:
+		return "running"
+	case RolloutPaused:
+		return "paused"
+	case RolloutHalted:
+		return "halted"
+	case RolloutAborted:
+		return "aborted"
+	case RolloutDone:
+		return "done"
+	}
+
+	return fmt.Sprintf("RolloutState(%d)", int(s))
+}
+
+// RolloutStage stage of a rollout
+type RolloutStage struct {
+	Name string
+	// Tokens sent in the stage, e.g. internal test devices, they are not sent by the percent stages
+	Tokens []string
+	// Percent of the recipients reached at the end of the stage, e.g. 1, 10, 100. The stage
+	// send the recipients of the buckets between the percent of the previous stage and it
+	Percent float64
+	// Pause wait after the stage before start the next one
+	Pause time.Duration
+}
+
+// RolloutConfig config of a Rollout
+type RolloutConfig struct {
+	// ID of the rollout, it salts the hash of the recipients so each rollout has different buckets
+	ID string
+	// Recipients tokens of the rollout
+	Recipients []string
+	Stages     []RolloutStage
+	// MaxFailureRate halt the rollout when the rate of failed tokens of a stage exceed it, 0 disable it
+	MaxFailureRate float64
+	// OnStage is called when a stage finishes
+	OnStage func(r StageResult)
+}
+
+// StageResult result of a stage
+type StageResult struct {
+	Name    string
+	Tokens  int
+	Success int
+	Failure int
+	// Errors of the batches that could not be sent
+	Errors []error
+}
+
+// FailureRate return the rate of failed tokens of the stage
+func (r StageResult) FailureRate() float64 {
+	if r.Success+r.Failure == 0 {
+		return 0
+	}
+
+	return float64(r.Failure) / float64(r.Success+r.Failure)
+}
+
+// RolloutHaltedError error returned when a stage exceed the max failure rate
+type RolloutHaltedError struct {
+	Stage       string
+	FailureRate float64
+}
+
+func (e *RolloutHaltedError) Error() string {
+	return fmt.Sprintf("rollout halted at stage %s: failure rate %.2f", e.Stage, e.FailureRate)
+}
+
+// RolloutStatus snapshot of a Rollout
+type RolloutStatus struct {
+	State RolloutState
+	// Stage index of the current stage
+	Stage int
+	// Results of the finished stages
+	Results []StageResult
+}
+
+// Rollout send the message of the client to its recipients in stages, halting when a stage fail
+type Rollout struct {
+	client  *Client
+	message message
+	cfg     RolloutConfig
+	// stages tokens of each stage
+	stages [][]string
+
+	mu      sync.Mutex
+	state   RolloutState
+	stage   int
+	offset  int
+	current StageResult
+	results []StageResult
+	abort   chan struct{}
+}
+
+// NewRollout create a rollout of a copy of the current message of the client
+func (c *Client) NewRollout(cfg RolloutConfig) *Rollout {
+	r := &Rollout{
+		client:  c,
+		message: *c.Message,
+		cfg:     cfg,
+		abort:   make(chan struct{}),
+	}
+	r.stages = r.split()
+
+	return r
+}
+
+// RolloutBucket return the bucket of the token in the rollout id, from 0 to 9999
+func RolloutBucket(id, token string) int {
+	return hashBucket(id, token, rolloutBuckets)
+}
+
+// hashBucket return a stable bucket of key salted by id, from 0 to n-1
+func hashBucket(id, key string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+
+	return int(h.Sum32() % uint32(n))
+}
+
+// split return the tokens of each stage
+func (r *Rollout) split() [][]string {
+	explicit := make(map[string]bool)
+	for _, s := range r.cfg.Stages {
+		for _, t := range s.Tokens {
+			explicit[t] = true
+		}
+	}
+
+	stages := make([][]string, len(r.cfg.Stages))
+	for i, s := range r.cfg.Stages {
+		stages[i] = append(stages[i], s.Tokens...)
+	}
+
+	for _, t := range r.cfg.Recipients {
+		if explicit[t] {
+			continue
+		}
+
+		bucket := RolloutBucket(r.cfg.ID, t)
+
+		from := 0
+		for i, s := range r.cfg.Stages {
+			if s.Percent <= 0 {
+				continue
+			}
+
+			to := int(s.Percent * rolloutBuckets / 100)
+			if bucket >= from && bucket < to {
+				stages[i] = append(stages[i], t)
+				break
+			}
+			if to > from {
+				from = to
+			}
+		}
+	}
+
+	return stages
+}
+
+// Run send the stages until the end, a halt or an abort
+func (r *Rollout) Run(ctx context.Context) error {
+	r.mu.Lock()
+	if r.state != RolloutPending {
+		r.mu.Unlock()
+		return ErrRolloutStarted
+	}
+	r.state = RolloutRunning
+	r.mu.Unlock()
+
+	return r.run(ctx)
+}
+
+// Resume continue a halted or aborted rollout, a halted rollout continue with the next stage
+// and an aborted one from where it stopped
+func (r *Rollout) Resume(ctx context.Context) error {
+	r.mu.Lock()
+	if r.state != RolloutHalted && r.state != RolloutAborted {
+		r.mu.Unlock()
+		return ErrRolloutNotStopped
+	}
+	r.state = RolloutRunning
+	r.abort = make(chan struct{})
+	r.mu.Unlock()
+
+	return r.run(ctx)
+}
+
+// Abort stop the rollout after the batch in progress or during a pause
+func (r *Rollout) Abort() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch r.state {
+	case RolloutRunning, RolloutPaused:
+		close(r.abort)
+		r.state = RolloutAborted
+	}
+}
+
+// Status return the status of the rollout
+func (r *Rollout) Status() RolloutStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return RolloutStatus{
+		State:   r.state,
+		Stage:   r.stage,
+		Results: append([]StageResult(nil), r.results...),
+	}
+}
+
+// run send the stages from the current position
+func (r *Rollout) run(ctx context.Context) error {
+	for {
+		r.mu.Lock()
+		if r.state == RolloutAborted {
+			r.mu.Unlock()
+			return ErrRolloutAborted
+		}
+		if r.stage >= len(r.stages) {
+			r.state = RolloutDone
+			r.mu.Unlock()
+			return nil
+		}
+		stage, offset, abort := r.stage, r.offset, r.abort
+		r.mu.Unlock()
+
+		tokens := r.stages[stage]
+		if offset < len(tokens) {
+			if err := r.sendBatch(ctx, tokens[offset:min(offset+maxRegistrationIds, len(tokens))]); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// The stage finished
+		result, err := r.finishStage()
+		if r.cfg.OnStage != nil {
+			r.cfg.OnStage(result)
+		}
+		if err != nil {
+			return err
+		}
+
+		if pause := r.cfg.Stages[stage].Pause; pause > 0 && stage < len(r.stages)-1 {
+			if err := r.pause(ctx, pause, abort); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sendBatch send the tokens and add their results to the current stage
+func (r *Rollout) sendBatch(ctx context.Context, tokens []string) error {
+	m := r.message
+	m.To, m.group = "", false
+	m.RegistrationIds = tokens
+
+	resp, err := r.client.send(ctx, &m)
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		// The batch is sent again on Resume
+		r.mu.Lock()
+		if r.state == RolloutRunning {
+			r.state = RolloutAborted
+		}
+		r.mu.Unlock()
+		return ctxErr
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.current.Tokens += len(tokens)
+	if err != nil {
+		r.current.Failure += len(tokens)
+		r.current.Errors = append(r.current.Errors, err)
+	} else {
+		r.current.Success += resp.Success
+		r.current.Failure += resp.Failure
+	}
+	r.offset += len(tokens)
+
+	return nil
+}
+
+// finishStage save the result of the current stage, move to the next one and halt the rollout
+// if the stage exceed the max failure rate
+func (r *Rollout) finishStage() (StageResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := r.current
+	result.Name = r.cfg.Stages[r.stage].Name
+	r.results = append(r.results, result)
+	r.current = StageResult{}
+	r.stage++
+	r.offset = 0
+
+	if rate := result.FailureRate(); r.cfg.MaxFailureRate > 0 && rate > r.cfg.MaxFailureRate {
+		if r.state == RolloutRunning {
+			r.state = RolloutHalted
+		}
+		return result, &RolloutHaltedError{Stage: result.Name, FailureRate: rate}
+	}
+
+	return result, nil
+}
+
+// pause wait d, ctx is done or the rollout is aborted
+func (r *Rollout) pause(ctx context.Context, d time.Duration, abort chan struct{}) error {
+	r.mu.Lock()
+	if r.state == RolloutRunning {
+		r.state = RolloutPaused
+	}
+	r.mu.Unlock()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-abort:
+		return ErrRolloutAborted
+	case <-ctx.Done():
+		r.Abort()
+		return ctx.Err()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.state == RolloutAborted {
+		return ErrRolloutAborted
+	}
+	r.state = RolloutRunning
+
+	return nil
+}
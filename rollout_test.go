@@ -0,0 +1,186 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func rolloutRecipients(n int) []string {
+	tokens := make([]string, n)
+	for i := range tokens {
+		tokens[i] = fmt.Sprintf("token-%d", i)
+	}
+
+	return tokens
+}
+
+func TestRolloutBucket(t *testing.T) {
+	t.Parallel()
+
+	if RolloutBucket("r1", "token") != RolloutBucket("r1", "token") {
+		t.Error("expected deterministic bucket")
+	}
+
+	// About 10% of the recipients are in the first 1000 buckets
+	var in int
+	for _, token := range rolloutRecipients(20000) {
+		if RolloutBucket("r1", token) < 1000 {
+			in++
+		}
+	}
+
+	if math.Abs(float64(in)/20000-0.1) > 0.01 {
+		t.Errorf("expected about 10%%, got %d", in)
+	}
+}
+
+func TestRollout_Stages(t *testing.T) {
+	t.Parallel()
+
+	var received sync.Map
+	var requests int32
+	server := newCampaignServer(&received, &requests)
+	defer server.Close()
+
+	client := NewClient("key", WithEndpoints(Endpoints{FCM: server.URL}))
+	client.SetData(map[string]string{"msg": "hi"})
+
+	recipients := rolloutRecipients(3000)
+	var stages []string
+	rollout := client.NewRollout(RolloutConfig{
+		ID:         "r1",
+		Recipients: recipients,
+		Stages: []RolloutStage{
+			{Name: "internal", Tokens: []string{"token-1", "qa-device"}, Pause: time.Millisecond},
+			{Name: "1%", Percent: 1},
+			{Name: "10%", Percent: 10},
+			{Name: "all", Percent: 100},
+		},
+		OnStage: func(r StageResult) { stages = append(stages, r.Name) },
+	})
+
+	// Client changes after the rollout is created are not sent
+	client.SetData(map[string]string{"msg": "other"})
+
+	if err := rollout.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	status := rollout.Status()
+	if status.State != RolloutDone || fmt.Sprint(stages) != "[internal 1% 10% all]" {
+		t.Errorf("unexpected status %+v stages %v", status, stages)
+	}
+
+	total := 0
+	for _, r := range status.Results {
+		total += r.Tokens
+	}
+	if total != 3001 || status.Results[0].Tokens != 2 {
+		t.Errorf("expected 3001 tokens sent, got %d %+v", total, status.Results)
+	}
+
+	// Every recipient was sent once
+	received.Range(func(k, v interface{}) bool {
+		if n := atomic.LoadInt32(v.(*int32)); n != 1 {
+			t.Errorf("%s sent %d times", k, n)
+		}
+		return true
+	})
+
+	if err := rollout.Run(context.Background()); !errors.Is(err, ErrRolloutStarted) {
+		t.Errorf("expected ErrRolloutStarted, got %v", err)
+	}
+}
+
+func TestRollout_HaltAndResume(t *testing.T) {
+	t.Parallel()
+
+	var received sync.Map
+	var requests int32
+	server := newCampaignServer(&received, &requests)
+	defer server.Close()
+
+	client := NewClient("key", WithEndpoints(Endpoints{FCM: server.URL}))
+	client.SetData(map[string]string{"msg": "hi"})
+
+	rollout := client.NewRollout(RolloutConfig{
+		ID:         "r1",
+		Recipients: rolloutRecipients(100),
+		Stages: []RolloutStage{
+			{Name: "canary", Tokens: []string{"bad-1", "good-1"}},
+			{Name: "all", Percent: 100},
+		},
+		MaxFailureRate: 0.2,
+	})
+
+	err := rollout.Run(context.Background())
+
+	var halted *RolloutHaltedError
+	if !errors.As(err, &halted) || halted.Stage != "canary" || halted.FailureRate != 0.5 {
+		t.Fatalf("expected halt at canary, got %v", err)
+	}
+
+	if status := rollout.Status(); status.State != RolloutHalted || status.Stage != 1 || requests != 1 {
+		t.Fatalf("unexpected status %+v after %d requests", status, requests)
+	}
+
+	if err := rollout.Resume(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := rollout.Status(); status.State != RolloutDone || status.Results[1].Tokens != 100 {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestRollout_AbortDuringPause(t *testing.T) {
+	t.Parallel()
+
+	var received sync.Map
+	var requests int32
+	server := newCampaignServer(&received, &requests)
+	defer server.Close()
+
+	client := NewClient("key", WithEndpoints(Endpoints{FCM: server.URL}))
+	client.SetData(map[string]string{"msg": "hi"})
+
+	rollout := client.NewRollout(RolloutConfig{
+		ID:         "r1",
+		Recipients: rolloutRecipients(100),
+		Stages: []RolloutStage{
+			{Name: "50%", Percent: 50, Pause: time.Hour},
+			{Name: "all", Percent: 100},
+		},
+	})
+
+	if err := rollout.Resume(context.Background()); !errors.Is(err, ErrRolloutNotStopped) {
+		t.Errorf("expected ErrRolloutNotStopped, got %v", err)
+	}
+
+	errs := make(chan error)
+	go func() { errs <- rollout.Run(context.Background()) }()
+
+	for rollout.Status().State != RolloutPaused {
+		time.Sleep(time.Millisecond)
+	}
+	rollout.Abort()
+
+	if err := <-errs; !errors.Is(err, ErrRolloutAborted) {
+		t.Fatalf("expected ErrRolloutAborted, got %v", err)
+	}
+
+	if err := rollout.Resume(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	status := rollout.Status()
+	if status.State != RolloutDone || status.Results[0].Tokens+status.Results[1].Tokens != 100 {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
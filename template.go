@@ -0,0 +1,362 @@
+package fcm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+const (
+	// Default last locale of the fallback chains
+	defaultLocale = "en"
+	// Extension of the template files
+	templateExt = ".json"
+)
+
+var (
+	// Errors
+	ErrTemplateNotFound = errors.New("template not found")
+	ErrTemplateIsEmpty  = errors.New("template has no title, body or data")
+)
+
+// Template texts of a notification in a locale, the texts use text/template syntax
+type Template struct {
+	Title string            `json:"title,omitempty"`
+	Body  string            `json:"body,omitempty"`
+	Data  map[string]string `json:"data,omitempty"`
+}
+
+// Rendered notification and data rendered from a template
+type Rendered struct {
+	// Locale of the template used
+	Locale       string
+	Notification *NotificationPayload
+	Data         map[string]string
+
+	// title and body are true when the template defines them
+	title, body bool
+}
+
+// Templates named templates per locale
+type Templates struct {
+	fallback string
+	// templates map of name and locale to the parsed template
+	templates map[string]map[string]*parsedTemplate
+}
+
+type parsedTemplate struct {
+	title *template.Template
+	body  *template.Template
+	data  map[string]*template.Template
+}
+
+// NewTemplates create an empty set of templates, fallback is the last locale of the chains, "en" if empty
+func NewTemplates(fallback string) *Templates {
+	if fallback == "" {
+		fallback = defaultLocale
+	}
+
+	return &Templates{
+		fallback:  normalizeLocale(fallback),
+		templates: make(map[string]map[string]*parsedTemplate),
+	}
+}
+
+// LoadTemplates load the templates of fsys, the files are <locale>/<name>.json with the
+// fields of Template, e.g. pt-BR/welcome.json. The templates are validated when loaded
+func LoadTemplates(fsys fs.FS, fallback string) (*Templates, error) {
+	ts := NewTemplates(fallback)
+
+	files, err := fs.Glob(fsys, "*/*"+templateExt)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		b, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return nil, err
+		}
+
+		var t Template
+		if err := json.Unmarshal(b, &t); err != nil {
+			return nil, fmt.Errorf("template %s: %w", f, err)
+		}
+
+		locale, name := path.Split(f)
+		name = strings.TrimSuffix(name, templateExt)
+		if err := ts.Add(name, strings.TrimSuffix(locale, "/"), t); err != nil {
+			return nil, fmt.Errorf("template %s: %w", f, err)
+		}
+	}
+
+	return ts, nil
+}
+
+// LoadTemplatesDir load the templates of the directory dir, see LoadTemplates
+func LoadTemplatesDir(dir string, fallback string) (*Templates, error) {
+	return LoadTemplates(os.DirFS(dir), fallback)
+}
+
+// Add parse and add the template name of locale
+func (ts *Templates) Add(name, locale string, t Template) error {
+	if t.Title == "" && t.Body == "" && len(t.Data) == 0 {
+		return ErrTemplateIsEmpty
+	}
+
+	pt := &parsedTemplate{data: make(map[string]*template.Template)}
+
+	var err error
+	if pt.title, err = parseText(name+".title", t.Title); err != nil {
+		return err
+	}
+
+	if pt.body, err = parseText(name+".body", t.Body); err != nil {
+		return err
+	}
+
+	for k, v := range t.Data {
+		if pt.data[k], err = parseText(name+".data."+k, v); err != nil {
+			return err
+		}
+	}
+
+	if ts.templates[name] == nil {
+		ts.templates[name] = make(map[string]*parsedTemplate)
+	}
+	ts.templates[name][normalizeLocale(locale)] = pt
+
+	return nil
+}
+
+// Locales return the locales of the template name
+func (ts *Templates) Locales(name string) []string {
+	var locales []string
+	for l := range ts.templates[name] {
+		locales = append(locales, l)
+	}
+	sort.Strings(locales)
+
+	return locales
+}
+
+// Render render the template name with vars, the locale falls back through its chain,
+// e.g. pt-BR, pt and the fallback locale
+func (ts *Templates) Render(name, locale string, vars interface{}) (*Rendered, error) {
+	byLocale, ok := ts.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+
+	for _, l := range ts.chain(locale) {
+		pt, ok := byLocale[l]
+		if !ok {
+			continue
+		}
+
+		r := &Rendered{Locale: l, title: pt.title != nil, body: pt.body != nil}
+
+		title, err := execute(pt.title, vars)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := execute(pt.body, vars)
+		if err != nil {
+			return nil, err
+		}
+
+		if title != "" || body != "" {
+			r.Notification = &NotificationPayload{Title: title, Body: body}
+		}
+
+		if len(pt.data) > 0 {
+			r.Data = make(map[string]string, len(pt.data))
+			for k, t := range pt.data {
+				if r.Data[k], err = execute(t, vars); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		return r, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s for locale %s", ErrTemplateNotFound, name, locale)
+}
+
+// chain return the fallback chain of locale
+func (ts *Templates) chain(locale string) []string {
+	var chain []string
+	l := normalizeLocale(locale)
+	for l != "" {
+		chain = append(chain, l)
+		i := strings.LastIndex(l, "-")
+		if i < 0 {
+			break
+		}
+		l = l[:i]
+	}
+
+	return append(chain, ts.fallback)
+}
+
+// Recipient token and the variables and locale used to render its template
+type Recipient struct {
+	Token  string
+	Locale string
+	Vars   interface{}
+}
+
+// SendTemplate render the template name for every recipient and send it with the options of
+// the message, the title and body defined by the template replace the ones of the notification of the message
+// and the rendered data is merged into its data. Recipients with the same rendered notification
+// are sent in the same multicast.
+// All the templates are rendered before send, it returns a map of token and result
+func (c *Client) SendTemplate(ctx context.Context, ts *Templates, name string, recipients []Recipient) (map[string]Result, error) {
+	type group struct {
+		rendered *Rendered
+		tokens   []string
+	}
+
+	var groups []*group
+	byKey := make(map[string]*group)
+	for _, r := range recipients {
+		rendered, err := ts.Render(name, r.Locale, r.Vars)
+		if err != nil {
+			return nil, fmt.Errorf("recipient %s: %w", r.Token, err)
+		}
+
+		b, err := json.Marshal(rendered)
+		if err != nil {
+			return nil, err
+		}
+
+		g, ok := byKey[string(b)]
+		if !ok {
+			g = &group{rendered: rendered}
+			byKey[string(b)] = g
+			groups = append(groups, g)
+		}
+		g.tokens = append(g.tokens, r.Token)
+	}
+
+	results := make(map[string]Result, len(recipients))
+	for _, g := range groups {
+		m := *c.Message
+		m.Notification = renderNotification(c.Message.Notification, g.rendered)
+		m.Data = mergeData(c.Message.Data, g.rendered.Data)
+
+		err := c.sendBatches(ctx, m, g.tokens, func(batch []string, resp *Response, err error) error {
+			if err != nil {
+				return err
+			}
+
+			for i, r := range resp.Results {
+				if i < len(batch) {
+					results[batch[i]] = r
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// renderNotification return a copy of n with the title and body defined by the template of
+// rendered, n if the template defines none of them
+func renderNotification(n *NotificationPayload, rendered *Rendered) *NotificationPayload {
+	if !rendered.title && !rendered.body {
+		return n
+	}
+
+	if n == nil {
+		return rendered.Notification
+	}
+
+	var title, body string
+	if rendered.Notification != nil {
+		title, body = rendered.Notification.Title, rendered.Notification.Body
+	}
+
+	cp := *n
+	if rendered.title {
+		cp.Title = title
+	}
+	if rendered.body {
+		cp.Body = body
+	}
+
+	return &cp
+}
+
+// mergeData return a copy of the data d with the values of rendered, d is replaced if it is not a map
+func mergeData(d interface{}, rendered map[string]string) interface{} {
+	if len(rendered) == 0 {
+		return d
+	}
+
+	switch base := d.(type) {
+	case map[string]string:
+		merged := make(map[string]string, len(base)+len(rendered))
+		for k, v := range base {
+			merged[k] = v
+		}
+		for k, v := range rendered {
+			merged[k] = v
+		}
+		return merged
+	case map[string]interface{}:
+		merged := make(map[string]interface{}, len(base)+len(rendered))
+		for k, v := range base {
+			merged[k] = v
+		}
+		for k, v := range rendered {
+			merged[k] = v
+		}
+		return merged
+	}
+
+	return rendered
+}
+
+// parseText parse the text of a template, missing variables are errors
+func parseText(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	return template.New(name).Option("missingkey=error").Parse(text)
+}
+
+// execute execute t with vars, a nil template renders an empty string
+func execute(t *template.Template, vars interface{}) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// normalizeLocale return locale in lower case with - as separator, e.g. pt_BR is pt-br
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.Replace(locale, "_", "-", -1))
+}
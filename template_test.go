@@ -0,0 +1,188 @@
+package fcm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+)
+
+func testTemplates(t *testing.T) *Templates {
+	fsys := fstest.MapFS{
+		"en/welcome.json":    {Data: []byte(`{"title":"Welcome {{.Name}}","body":"Hello","data":{"screen":"home/{{.Name}}"}}`)},
+		"pt/welcome.json":    {Data: []byte(`{"title":"Bem-vindo {{.Name}}","body":"Olá"}`)},
+		"pt-BR/welcome.json": {Data: []byte(`{"title":"Bem-vindo, {{.Name}}!","body":"Oi"}`)},
+		"README.md":          {Data: []byte(`ignored`)},
+	}
+
+	ts, err := LoadTemplates(fsys, "en")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return ts
+}
+
+func TestTemplates_Render(t *testing.T) {
+	t.Parallel()
+
+	ts := testTemplates(t)
+	vars := map[string]string{"Name": "Ana"}
+
+	tests := []struct {
+		locale string
+		used   string
+		title  string
+	}{
+		{"pt-BR", "pt-br", "Bem-vindo, Ana!"},
+		{"pt_PT", "pt", "Bem-vindo Ana"},
+		{"es", "en", "Welcome Ana"},
+	}
+
+	for _, tc := range tests {
+		r, err := ts.Render("welcome", tc.locale, vars)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.locale, err)
+		}
+
+		if r.Locale != tc.used {
+			t.Errorf("%s: expected locale %s, got %s", tc.locale, tc.used, r.Locale)
+		}
+
+		if r.Notification.Title != tc.title {
+			t.Errorf("%s: expected %s, got %s", tc.locale, tc.title, r.Notification.Title)
+		}
+	}
+
+	r, _ := ts.Render("welcome", "en", vars)
+	if r.Data["screen"] != "home/Ana" {
+		t.Errorf("expected home/Ana, got %s", r.Data["screen"])
+	}
+
+	if _, err := ts.Render("welcome", "en", map[string]string{}); err == nil {
+		t.Error("expected missing variable error")
+	}
+
+	if _, err := ts.Render("goodbye", "en", vars); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("expected ErrTemplateNotFound, got %v", err)
+	}
+}
+
+func TestLoadTemplates_Invalid(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"en/broken.json": {Data: []byte(`{"title":"Welcome {{.Name"}`)},
+	}
+
+	if _, err := LoadTemplates(fsys, ""); err == nil {
+		t.Error("expected parse error")
+	}
+
+	fsys = fstest.MapFS{
+		"en/empty.json": {Data: []byte(`{}`)},
+	}
+
+	if _, err := LoadTemplates(fsys, ""); !errors.Is(err, ErrTemplateIsEmpty) {
+		t.Errorf("expected ErrTemplateIsEmpty, got %v", err)
+	}
+}
+
+func TestClient_SendTemplate(t *testing.T) {
+	t.Parallel()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		var m message
+		json.NewDecoder(req.Body).Decode(&m)
+
+		if m.Notification.Sound != "default" {
+			t.Errorf("expected the sound of the client notification, got %q", m.Notification.Sound)
+		}
+
+		data, _ := m.Data.(map[string]interface{})
+		if data["campaign"] != "spring" {
+			t.Errorf("expected the data of the client message, got %v", m.Data)
+		}
+
+		results := make([]Result, len(m.RegistrationIds))
+		for i := range results {
+			results[i].MessageID = MessageID(m.Notification.Title)
+		}
+
+		rw.WriteHeader(http.StatusOK)
+		json.NewEncoder(rw).Encode(map[string]interface{}{"results": results})
+	}))
+
+	defer server.Close()
+
+	client := NewClient("test")
+	client.Endpoints.FCM = server.URL
+	client.SetNotification(&NotificationPayload{Title: "Title", Sound: "default"})
+	client.SetData(map[string]string{"campaign": "spring"})
+
+	results, err := client.SendTemplate(context.Background(), testTemplates(t), "welcome", []Recipient{
+		{Token: "token 1", Locale: "pt-BR", Vars: map[string]string{"Name": "Ana"}},
+		{Token: "token 2", Locale: "en", Vars: map[string]string{"Name": "Bob"}},
+		{Token: "token 3", Locale: "pt-BR", Vars: map[string]string{"Name": "Ana"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+
+	if results["token 3"].MessageID != "Bem-vindo, Ana!" {
+		t.Errorf("unexpected result %+v", results["token 3"])
+	}
+
+	if results["token 2"].MessageID != "Welcome Bob" {
+		t.Errorf("unexpected result %+v", results["token 2"])
+	}
+
+	if client.Message.Notification.Title != "Title" {
+		t.Errorf("expected the client notification untouched, got %s", client.Message.Notification.Title)
+	}
+}
+
+func TestClient_SendTemplateTitleOnly(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var m message
+		json.NewDecoder(req.Body).Decode(&m)
+
+		if m.Notification.Title != "Hi Ana" || m.Notification.Body != "static body" {
+			t.Errorf("expected the rendered title and the client body, got %q and %q", m.Notification.Title, m.Notification.Body)
+		}
+
+		rw.WriteHeader(http.StatusOK)
+		json.NewEncoder(rw).Encode(map[string]interface{}{"results": []Result{{MessageID: "1"}}})
+	}))
+
+	defer server.Close()
+
+	ts := NewTemplates("en")
+	if err := ts.Add("greeting", "en", Template{Title: "Hi {{.Name}}"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	client := NewClient("test")
+	client.Endpoints.FCM = server.URL
+	client.SetNotification(&NotificationPayload{Title: "Title", Body: "static body"})
+
+	_, err := client.SendTemplate(context.Background(), ts, "greeting", []Recipient{
+		{Token: "token 1", Locale: "en", Vars: map[string]string{"Name": "Ana"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
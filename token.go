@@ -0,0 +1,126 @@
+package fcm
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Platforms returned by IID
+	PlatformAndroid Platform = "ANDROID"
+	PlatformIOS     Platform = "IOS"
+	PlatformChrome  Platform = "CHROME"
+
+	// Layout of the dates returned by IID
+	iidDateLayout = "2006-01-02"
+)
+
+var (
+	// Errors
+	ErrInvalidToken = errors.New("invalid token")
+	ErrUnknownToken = errors.New("unknown token")
+)
+
+// Platform of the app instance of a token
+type Platform string
+
+// Topic subscription of a token
+type Topic struct {
+	Name    string
+	AddDate time.Time
+}
+
+// TokenInfo info about a token returned by IID
+type TokenInfo struct {
+	StatusCode       int
+	Application      string
+	AuthorizedEntity string
+	Platform         Platform
+	AppSigner        string
+	AttestStatus     string
+	ConnectionType   string
+	ConnectDate      time.Time
+	Topics           []Topic
+}
+
+// HasTopic return true if the token is subscribed to the topic
+func (ti *TokenInfo) HasTopic(name string) bool {
+	for _, t := range ti.Topics {
+		if t.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TokenError error returned by IID when reject a token
+type TokenError struct {
+	StatusCode int
+	// Reason error message returned by IID
+	Reason string
+	// Err is ErrInvalidToken or ErrUnknownToken when the reason is known
+	Err error
+}
+
+func (e *TokenError) Error() string {
+	return fmt.Sprintf("statusCode: %d error: %s", e.StatusCode, e.Reason)
+}
+
+func (e *TokenError) Unwrap() error {
+	return e.Err
+}
+
+// newTokenError create TokenError classifying the reason returned by IID
+func newTokenError(statusCode int, reason string) *TokenError {
+	e := &TokenError{StatusCode: statusCode, Reason: reason}
+
+	switch {
+	case reason == "InvalidToken":
+		e.Err = ErrInvalidToken
+	case statusCode == 404, strings.HasPrefix(reason, "No information found"):
+		e.Err = ErrUnknownToken
+	}
+
+	return e
+}
+
+// toTokenInfo convert the details returned by IID to TokenInfo
+func (td *tokenDetails) toTokenInfo(statusCode int) *TokenInfo {
+	ti := &TokenInfo{
+		StatusCode:       statusCode,
+		Application:      td.Application,
+		AuthorizedEntity: td.AuthorizedEntity,
+		Platform:         Platform(strings.ToUpper(td.Platform)),
+		AppSigner:        td.AppSigner,
+		AttestStatus:     td.AttestStatus,
+		ConnectionType:   td.ConnectionType,
+		ConnectDate:      parseIIDDate(td.ConnectDate),
+	}
+
+	for name, v := range td.Rel["topics"] {
+		ti.Topics = append(ti.Topics, Topic{Name: name, AddDate: parseIIDDate(v["addDate"])})
+	}
+
+	sort.Slice(ti.Topics, func(i, j int) bool {
+		return ti.Topics[i].Name < ti.Topics[j].Name
+	})
+
+	return ti
+}
+
+// parseIIDDate parse a date returned by IID, return zero time if the date is not valid
+func parseIIDDate(s string) time.Time {
+	if d, err := time.Parse(iidDateLayout, s); err == nil {
+		return d
+	}
+
+	if d, err := time.Parse(time.RFC3339, s); err == nil {
+		return d
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,39 @@
+package fcm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenInfo_HasTopic(t *testing.T) {
+	t.Parallel()
+
+	ti := &TokenInfo{Topics: []Topic{{Name: "news"}}}
+
+	if !ti.HasTopic("news") {
+		t.Error("expected topic news")
+	}
+
+	if ti.HasTopic("sports") {
+		t.Error("unexpected topic sports")
+	}
+}
+
+func TestParseIIDDate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in  string
+		out time.Time
+	}{
+		{"2015-07-30", time.Date(2015, 7, 30, 0, 0, 0, 0, time.UTC)},
+		{"2015-07-30T10:00:00Z", time.Date(2015, 7, 30, 10, 0, 0, 0, time.UTC)},
+		{"yesterday", time.Time{}},
+	}
+
+	for _, tc := range tests {
+		if d := parseIIDDate(tc.in); !d.Equal(tc.out) {
+			t.Errorf("%s: expected %v, got %v", tc.in, tc.out, d)
+		}
+	}
+}
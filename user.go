@@ -0,0 +1,138 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// Errors
+	ErrNoTokenResolver = errors.New("token resolver is not set")
+)
+
+// TokenResolver resolve a user to all their registered tokens
+type TokenResolver interface {
+	ResolveTokens(ctx context.Context, userID string) ([]string, error)
+}
+
+// TokenResolverFunc allow use an ordinary function as TokenResolver
+type TokenResolverFunc func(ctx context.Context, userID string) ([]string, error)
+
+// ResolveTokens call f(ctx, userID)
+func (f TokenResolverFunc) ResolveTokens(ctx context.Context, userID string) ([]string, error) {
+	return f(ctx, userID)
+}
+
+// UserResult delivery summary for a user
+type UserResult struct {
+	UserID string
+	// Tokens resolved for the user
+	Tokens  []string
+	Success int
+	Failure int
+	// Errors map of token and FCM error for the failed tokens
+	Errors map[string]string
+	// Canonical map of token and the canonical registration id returned by FCM
+	Canonical map[string]string
+	// Err is set when the tokens could not be resolved or a batch could not be sent
+	Err error
+}
+
+// SetTokenResolver set the resolver used by SendToUsers
+func (c *Client) SetTokenResolver(r TokenResolver) {
+	c.resolver = r
+}
+
+// SendToUsers resolve the users to their tokens and send them the data and notification of message,
+// tokens are sent in batches of 1000 ids and the results are summarized per user
+func (c *Client) SendToUsers(ctx context.Context, userIDs ...string) ([]*UserResult, error) {
+	if c.resolver == nil {
+		return nil, ErrNoTokenResolver
+	}
+
+	if c.Message.Data == nil && c.Message.Notification == nil {
+		return nil, ErrDataIsEmpty
+	}
+
+	results := make([]*UserResult, len(userIDs))
+	// owners map a token to the users that have registered it
+	owners := make(map[string][]*UserResult)
+	var tokens []string
+
+	for i, id := range userIDs {
+		ur := &UserResult{UserID: id}
+		results[i] = ur
+
+		ts, err := c.resolver.ResolveTokens(ctx, id)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return results, ctxErr
+			}
+			ur.Err = err
+			continue
+		}
+
+		// A token resolved twice for the same user is owned and counted once
+		seen := make(map[string]bool, len(ts))
+		for _, t := range ts {
+			if seen[t] {
+				continue
+			}
+			seen[t] = true
+			ur.Tokens = append(ur.Tokens, t)
+
+			if _, ok := owners[t]; !ok {
+				tokens = append(tokens, t)
+			}
+			owners[t] = append(owners[t], ur)
+		}
+	}
+
+	err := c.sendBatches(ctx, *c.Message, tokens, func(batch []string, resp *Response, err error) error {
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			for _, t := range batch {
+				for _, ur := range owners[t] {
+					ur.Err = err
+				}
+			}
+			return nil
+		}
+
+		for i, r := range resp.Results {
+			if i >= len(batch) {
+				break
+			}
+			t := batch[i]
+			for _, ur := range owners[t] {
+				ur.addResult(t, r)
+			}
+		}
+
+		return nil
+	})
+
+	return results, err
+}
+
+// addResult add the result for token t to the summary
+func (ur *UserResult) addResult(t string, r Result) {
+	if r.Error != "" {
+		ur.Failure++
+		if ur.Errors == nil {
+			ur.Errors = make(map[string]string)
+		}
+		ur.Errors[t] = r.Error
+		return
+	}
+
+	ur.Success++
+	if r.RegistrationID != "" {
+		if ur.Canonical == nil {
+			ur.Canonical = make(map[string]string)
+		}
+		ur.Canonical[t] = r.RegistrationID
+	}
+}
@@ -0,0 +1,112 @@
+package fcm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClient_SendToUsers(t *testing.T) {
+	t.Parallel()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		var m message
+		if err := json.NewDecoder(req.Body).Decode(&m); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if len(m.RegistrationIds) > 1000 {
+			t.Errorf("expected at most 1000 ids, got %d", len(m.RegistrationIds))
+		}
+
+		var results []Result
+		for _, id := range m.RegistrationIds {
+			if strings.HasPrefix(id, "bad") {
+				results = append(results, Result{Error: "NotRegistered"})
+			} else {
+				results = append(results, Result{MessageID: "1"})
+			}
+		}
+
+		rw.WriteHeader(http.StatusOK)
+		json.NewEncoder(rw).Encode(map[string]interface{}{"results": results})
+	}))
+
+	defer server.Close()
+
+	var many []string
+	for i := 0; i < 1500; i++ {
+		many = append(many, fmt.Sprintf("token %d", i))
+	}
+
+	tokens := map[string][]string{
+		"user1": {"token a", "bad token"},
+		"user2": {"token a", "token a"},
+		"user3": many,
+	}
+
+	client := NewClient("test")
+	client.Endpoints.FCM = server.URL
+	client.SetData(map[string]string{"body": "Test"})
+	client.SetTokenResolver(TokenResolverFunc(func(ctx context.Context, id string) ([]string, error) {
+		ts, ok := tokens[id]
+		if !ok {
+			return nil, errors.New("unknown user")
+		}
+		return ts, nil
+	}))
+
+	results, err := client.SendToUsers(context.Background(), "user1", "user2", "user3", "user4")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+
+	if results[0].Success != 1 || results[0].Failure != 1 {
+		t.Errorf("expected 1 success and 1 failure, got %d and %d", results[0].Success, results[0].Failure)
+	}
+
+	if results[0].Errors["bad token"] != "NotRegistered" {
+		t.Errorf("expected NotRegistered, got %s", results[0].Errors["bad token"])
+	}
+
+	if results[1].Success != 1 || len(results[1].Tokens) != 1 {
+		t.Errorf("expected 1 success of 1 token, got %d of %v", results[1].Success, results[1].Tokens)
+	}
+
+	if results[2].Success != 1500 {
+		t.Errorf("expected 1500, got %d", results[2].Success)
+	}
+
+	if results[3].Err == nil {
+		t.Error("expected resolver error")
+	}
+
+	if client.Message.RegistrationIds != nil {
+		t.Errorf("expected client message untouched, got %v", client.Message.RegistrationIds)
+	}
+}
+
+func TestClient_SendToUsersWithoutResolver(t *testing.T) {
+	t.Parallel()
+
+	client := NewClient("test")
+	client.SetData(map[string]string{"body": "Test"})
+
+	_, err := client.SendToUsers(context.Background(), "user1")
+	if err != ErrNoTokenResolver {
+		t.Errorf("expected ErrNoTokenResolver, got %v", err)
+	}
+}
@@ -0,0 +1,329 @@
+package fcm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// Errors
+	ErrV1Group = errors.New("device groups are not supported by the v1 API")
+)
+
+// V1Request request body of the FCM HTTP v1 API
+type V1Request struct {
+	ValidateOnly bool       `json:"validate_only,omitempty"`
+	Message      *V1Message `json:"message"`
+}
+
+// V1Message message of the FCM HTTP v1 API
+type V1Message struct {
+	Token        string            `json:"token,omitempty"`
+	Topic        string            `json:"topic,omitempty"`
+	Condition    string            `json:"condition,omitempty"`
+	Data         map[string]string `json:"data,omitempty"`
+	Notification *V1Notification   `json:"notification,omitempty"`
+	Android      *V1AndroidConfig  `json:"android,omitempty"`
+	Apns         *V1ApnsConfig     `json:"apns,omitempty"`
+	FcmOptions   *FcmOptions       `json:"fcm_options,omitempty"`
+}
+
+// V1Notification notification shared by all the platforms
+type V1Notification struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+	Image string `json:"image,omitempty"`
+}
+
+// V1AndroidConfig options of Android messages
+type V1AndroidConfig struct {
+	CollapseKey           string                 `json:"collapse_key,omitempty"`
+	Priority              string                 `json:"priority,omitempty"`
+	TTL                   string                 `json:"ttl,omitempty"`
+	RestrictedPackageName string                 `json:"restricted_package_name,omitempty"`
+	Notification          *V1AndroidNotification `json:"notification,omitempty"`
+	FcmOptions            *FcmOptions            `json:"fcm_options,omitempty"`
+}
+
+// V1AndroidNotification notification of Android messages
+type V1AndroidNotification struct {
+	Icon         string  `json:"icon,omitempty"`
+	Color        string  `json:"color,omitempty"`
+	Sound        string  `json:"sound,omitempty"`
+	Tag          string  `json:"tag,omitempty"`
+	ClickAction  string  `json:"click_action,omitempty"`
+	BodyLocKey   string  `json:"body_loc_key,omitempty"`
+	BodyLocArgs  LocArgs `json:"body_loc_args,omitempty"`
+	TitleLocKey  string  `json:"title_loc_key,omitempty"`
+	TitleLocArgs LocArgs `json:"title_loc_args,omitempty"`
+	ChannelID    string  `json:"channel_id,omitempty"`
+
+	Image                 string               `json:"image,omitempty"`
+	Ticker                string               `json:"ticker,omitempty"`
+	Sticky                bool                 `json:"sticky,omitempty"`
+	EventTime             string               `json:"event_time,omitempty"`
+	LocalOnly             bool                 `json:"local_only,omitempty"`
+	NotificationPriority  NotificationPriority `json:"notification_priority,omitempty"`
+	DefaultSound          bool                 `json:"default_sound,omitempty"`
+	DefaultVibrateTimings bool                 `json:"default_vibrate_timings,omitempty"`
+	VibrateTimings        []Duration           `json:"vibrate_timings,omitempty"`
+	Visibility            Visibility           `json:"visibility,omitempty"`
+	NotificationCount     *int                 `json:"notification_count,omitempty"`
+	LightSettings         *V1LightSettings     `json:"light_settings,omitempty"`
+}
+
+// V1LightSettings settings of the LED of the device on Android
+type V1LightSettings struct {
+	Color            V1Color  `json:"color"`
+	LightOnDuration  Duration `json:"light_on_duration"`
+	LightOffDuration Duration `json:"light_off_duration"`
+}
+
+// V1Color color with the components between 0 and 1
+type V1Color struct {
+	Red   float64 `json:"red"`
+	Green float64 `json:"green"`
+	Blue  float64 `json:"blue"`
+	Alpha float64 `json:"alpha"`
+}
+
+// V1ApnsConfig options of APNs messages
+type V1ApnsConfig struct {
+	Headers    map[string]string      `json:"headers,omitempty"`
+	Payload    map[string]interface{} `json:"payload,omitempty"`
+	FcmOptions *V1ApnsFcmOptions      `json:"fcm_options,omitempty"`
+}
+
+// V1ApnsFcmOptions options of FCM features of APNs messages
+type V1ApnsFcmOptions struct {
+	AnalyticsLabel string `json:"analytics_label,omitempty"`
+	Image          string `json:"image,omitempty"`
+}
+
+// V1 convert the message to requests of the v1 API, one request per recipient as the v1 API
+// does not support multicast
+func (m *message) V1() ([]*V1Request, error) {
+	if m.group {
+		return nil, ErrV1Group
+	}
+
+	data, err := v1Data(m.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []V1Message
+	switch {
+	case m.Condition != "":
+		targets = append(targets, V1Message{Condition: m.Condition})
+	case strings.HasPrefix(m.To, topicPrefix):
+		targets = append(targets, V1Message{Topic: strings.TrimPrefix(m.To, topicPrefix)})
+	case m.To != "":
+		targets = append(targets, V1Message{Token: m.To})
+	default:
+		for _, id := range m.RegistrationIds {
+			targets = append(targets, V1Message{Token: id})
+		}
+	}
+
+	requests := make([]*V1Request, len(targets))
+	for i := range targets {
+		v1 := &targets[i]
+		v1.Data = data
+		v1.Notification = m.v1Notification()
+		v1.Android = m.v1Android()
+		v1.Apns = m.v1Apns()
+		v1.FcmOptions = m.FcmOptions
+
+		requests[i] = &V1Request{ValidateOnly: m.DryRun, Message: v1}
+	}
+
+	return requests, nil
+}
+
+func (m *message) v1Notification() *V1Notification {
+	n := m.Notification
+	if n == nil || (n.Title == "" && n.Body == "" && n.Image == "") {
+		return nil
+	}
+
+	return &V1Notification{Title: n.Title, Body: n.Body, Image: n.Image}
+}
+
+func (m *message) v1Android() *V1AndroidConfig {
+	a := &V1AndroidConfig{
+		CollapseKey:           m.CollapseKey,
+		Priority:              strings.ToUpper(m.Priority),
+		RestrictedPackageName: m.RestrictedPackageName,
+		FcmOptions:            m.FcmOptions,
+	}
+
+	if m.TimeToLive > 0 {
+		a.TTL = fmt.Sprintf("%ds", m.TimeToLive)
+	}
+
+	if n := m.Notification; n != nil {
+		a.Notification = &V1AndroidNotification{
+			Icon:         n.Icon,
+			Color:        n.Color,
+			Sound:        n.Sound,
+			Tag:          n.Tag,
+			ClickAction:  n.ClickAction,
+			BodyLocKey:   n.BodyLocKey,
+			BodyLocArgs:  n.BodyLocArgs,
+			TitleLocKey:  n.TitleLocKey,
+			TitleLocArgs: n.TitleLocArgs,
+			ChannelID:    n.AndroidChannelID,
+
+			Image:                 n.Image,
+			Ticker:                n.Ticker,
+			Sticky:                n.Sticky,
+			LocalOnly:             n.LocalOnly,
+			NotificationPriority:  n.NotificationPriority,
+			DefaultSound:          n.DefaultSound,
+			DefaultVibrateTimings: n.DefaultVibrateTimings,
+			VibrateTimings:        n.VibrateTimings,
+			Visibility:            n.Visibility,
+			NotificationCount:     n.NotificationCount,
+		}
+
+		if n.EventTime != nil {
+			a.Notification.EventTime = n.EventTime.UTC().Format(time.RFC3339Nano)
+		}
+
+		if ls := n.LightSettings; ls != nil {
+			r, g, b := parseColor(ls.Color)
+			a.Notification.LightSettings = &V1LightSettings{
+				Color:            V1Color{Red: r, Green: g, Blue: b, Alpha: 1},
+				LightOnDuration:  ls.LightOnDuration,
+				LightOffDuration: ls.LightOffDuration,
+			}
+		}
+	}
+
+	if *a == (V1AndroidConfig{}) {
+		return nil
+	}
+
+	return a
+}
+
+func (m *message) v1Apns() *V1ApnsConfig {
+	aps := make(map[string]interface{})
+	headers := make(map[string]string)
+
+	switch m.Priority {
+	case HighPriority:
+		headers["apns-priority"] = "10"
+	case NormalPriority:
+		headers["apns-priority"] = "5"
+	}
+
+	if m.CollapseKey != "" {
+		headers["apns-collapse-id"] = m.CollapseKey
+	}
+
+	if m.ContentAvailable {
+		aps["content-available"] = 1
+	}
+
+	if m.MutableContent {
+		aps["mutable-content"] = 1
+	}
+
+	if n := m.Notification; n != nil {
+		alert := make(map[string]interface{})
+		setString(alert, "title", n.Title)
+		setString(alert, "subtitle", n.Subtitle)
+		setString(alert, "body", n.Body)
+		setString(alert, "loc-key", n.BodyLocKey)
+		setString(alert, "title-loc-key", n.TitleLocKey)
+		if len(n.BodyLocArgs) > 0 {
+			alert["loc-args"] = n.BodyLocArgs
+		}
+		if len(n.TitleLocArgs) > 0 {
+			alert["title-loc-args"] = n.TitleLocArgs
+		}
+		if len(alert) > 0 {
+			aps["alert"] = alert
+		}
+
+		if n.CriticalSound != nil {
+			aps["sound"] = n.CriticalSound
+		} else {
+			setString(aps, "sound", n.Sound)
+		}
+		setString(aps, "category", n.ClickAction)
+		if badge, err := strconv.Atoi(n.Badge); err == nil {
+			aps["badge"] = badge
+		}
+	}
+
+	a := &V1ApnsConfig{}
+	if len(headers) > 0 {
+		a.Headers = headers
+	}
+	if len(aps) > 0 {
+		a.Payload = map[string]interface{}{"aps": aps}
+	}
+	if m.FcmOptions != nil {
+		a.FcmOptions = &V1ApnsFcmOptions{AnalyticsLabel: m.FcmOptions.AnalyticsLabel}
+	}
+	if m.Notification != nil && m.Notification.Image != "" {
+		if a.FcmOptions == nil {
+			a.FcmOptions = &V1ApnsFcmOptions{}
+		}
+		a.FcmOptions.Image = m.Notification.Image
+	}
+
+	if a.Headers == nil && a.Payload == nil && a.FcmOptions == nil {
+		return nil
+	}
+
+	return a
+}
+
+// v1Data convert data to the map of strings required by the v1 API,
+// values that are not strings are encoded as JSON
+func v1Data(d interface{}) (map[string]string, error) {
+	if d == nil {
+		return nil, nil
+	}
+
+	if m, ok := d.(map[string]string); ok {
+		return m, nil
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("data must be a JSON object: %v", err)
+	}
+
+	data := make(map[string]string, len(raw))
+	for k, v := range raw {
+		var s string
+		if err := json.Unmarshal(v, &s); err == nil {
+			data[k] = s
+		} else {
+			data[k] = string(v)
+		}
+	}
+
+	return data, nil
+}
+
+// setString set m[k] if v is not empty
+func setString(m map[string]interface{}, k, v string) {
+	if v != "" {
+		m[k] = v
+	}
+}
@@ -0,0 +1,75 @@
+package fcm
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMessage_V1(t *testing.T) {
+	t.Parallel()
+
+	client := NewClient("key")
+	client.PushMultipleNotification([]string{"token 1", "token 2"}, &NotificationPayload{
+		Title: "a title",
+		Body:  "a body",
+		Badge: "3",
+	})
+	client.SetData(map[string]interface{}{"count": 1, "msg": "hello"})
+	client.Message.Priority = HighPriority
+	client.Message.TimeToLive = 60
+	client.SetAnalyticsLabel("campaign")
+
+	requests, err := client.Message.V1()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("expected 2, got %d", len(requests))
+	}
+
+	m := requests[1].Message
+	if m.Token != "token 2" {
+		t.Errorf("expected token 2, got %s", m.Token)
+	}
+
+	if m.Data["count"] != "1" || m.Data["msg"] != "hello" {
+		t.Errorf("unexpected data %v", m.Data)
+	}
+
+	if m.Android.TTL != "60s" || m.Android.Priority != "HIGH" {
+		t.Errorf("unexpected android config %+v", m.Android)
+	}
+
+	if m.FcmOptions.AnalyticsLabel != "campaign" || m.Apns.FcmOptions.AnalyticsLabel != "campaign" {
+		t.Error("expected analytics label")
+	}
+
+	b, err := json.Marshal(m.Apns.Payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `{"aps":{"alert":{"body":"a body","title":"a title"},"badge":3}}`
+	if string(b) != expected {
+		t.Errorf("expected %s, got %s", expected, b)
+	}
+}
+
+func TestMessage_V1Targets(t *testing.T) {
+	t.Parallel()
+
+	client := NewClient("key")
+	data := map[string]string{"body": "Test"}
+
+	client.PushSingle("/topics/news", data)
+	requests, err := client.Message.V1()
+	if err != nil || requests[0].Message.Topic != "news" {
+		t.Errorf("expected topic news, got %v", err)
+	}
+
+	client.PushGroup("key", data)
+	if _, err := client.Message.V1(); err != ErrV1Group {
+		t.Errorf("expected ErrV1Group, got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// Errors
+	ErrNoVariants           = errors.New("experiment has no variants")
+	ErrInvalidVariantWeight = errors.New("variant weight must be greater than 0")
+)
+
+// Variant content of the message tested in an experiment
+type Variant struct {
+	Name string
+	// Weight relative to the weights of the other variants
+	Weight int
+	// Notification and Data of the variant, nil keeps the ones of the client message
+	Notification *NotificationPayload
+	Data         interface{}
+}
+
+// Experiment A/B test of the variants of a message
+type Experiment struct {
+	// ID of the experiment, it salts the assignment so each experiment assign the recipients differently
+	ID       string
+	Variants []Variant
+	// OnAssign is called for every recipient when its variant is assigned, before the variants are
+	// sent, e.g. to record the exposure in the analytics of the experiment
+	OnAssign func(a VariantAssignment)
+}
+
+// VariantRecipient recipient of an experiment
+type VariantRecipient struct {
+	Token string
+	// Key used to assign the variant, e.g. the user id so all the tokens of a user get the same
+	// variant, the token is used if empty
+	Key string
+}
+
+// VariantAssignment variant sent to a recipient and its result
+type VariantAssignment struct {
+	Token   string
+	Key     string
+	Variant string
+	// MessageID returned by FCM for the token
+	MessageID MessageID
+	// Error returned by FCM for the token
+	Error string
+	// Err is set when the batch of the token could not be sent
+	Err error
+}
+
+// validate return error if the experiment can't assign variants or a variant can't be sent with m
+func (e *Experiment) validate(m *message) error {
+	if len(e.Variants) == 0 {
+		return ErrNoVariants
+	}
+
+	for _, v := range e.Variants {
+		if v.Weight <= 0 {
+			return ErrInvalidVariantWeight
+		}
+
+		if v.Data == nil && v.Notification == nil && m.Data == nil && m.Notification == nil {
+			return fmt.Errorf("variant %s: %w", v.Name, ErrDataIsEmpty)
+		}
+
+		if v.Notification != nil {
+			if err := v.Notification.validate(); err != nil {
+				return fmt.Errorf("variant %s: %w", v.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Assign return the index of the variant of key, the same key always gets the same variant
+func (e *Experiment) Assign(key string) int {
+	total := 0
+	for _, v := range e.Variants {
+		total += v.Weight
+	}
+
+	bucket := hashBucket(e.ID, key, total)
+	for i, v := range e.Variants {
+		if bucket < v.Weight {
+			return i
+		}
+		bucket -= v.Weight
+	}
+
+	return len(e.Variants) - 1
+}
+
+// SendVariants assign a variant to each recipient and send each variant to its recipients in batches
+// of 1000 ids, the assignments are returned in the order of the recipients with the message ids
+func (c *Client) SendVariants(ctx context.Context, e Experiment, recipients []VariantRecipient) ([]*VariantAssignment, error) {
+	if err := e.validate(c.Message); err != nil {
+		return nil, err
+	}
+
+	assignments := make([]*VariantAssignment, len(recipients))
+	groups := make([][]*VariantAssignment, len(e.Variants))
+	tokens := make([][]string, len(e.Variants))
+
+	for i, r := range recipients {
+		key := r.Key
+		if key == "" {
+			key = r.Token
+		}
+
+		v := e.Assign(key)
+		a := &VariantAssignment{Token: r.Token, Key: r.Key, Variant: e.Variants[v].Name}
+		assignments[i] = a
+		groups[v] = append(groups[v], a)
+		tokens[v] = append(tokens[v], r.Token)
+
+		if e.OnAssign != nil {
+			e.OnAssign(*a)
+		}
+	}
+
+	for i, v := range e.Variants {
+		m := *c.Message
+		if v.Notification != nil {
+			m.Notification = v.Notification
+		}
+		if v.Data != nil {
+			m.Data = v.Data
+		}
+
+		// Batches are sent in order, sent is the number of assignments of the group already sent
+		group, sent := groups[i], 0
+		err := c.sendBatches(ctx, m, tokens[i], func(batch []string, resp *Response, err error) error {
+			assigned := group[sent : sent+len(batch)]
+			sent += len(batch)
+
+			if err != nil {
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return ctxErr
+				}
+				for _, a := range assigned {
+					a.Err = err
+				}
+				return nil
+			}
+
+			for j, r := range resp.Results {
+				if j >= len(assigned) {
+					break
+				}
+				assigned[j].MessageID = r.MessageID
+				assigned[j].Error = r.Error
+			}
+
+			return nil
+		})
+		if err != nil {
+			return assignments, err
+		}
+	}
+
+	return assignments, nil
+}
@@ -0,0 +1,136 @@
+package fcm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestExperiment_Assign(t *testing.T) {
+	t.Parallel()
+
+	e := Experiment{ID: "exp-1", Variants: []Variant{{Name: "a", Weight: 3}, {Name: "b", Weight: 1}}}
+
+	counts := make([]int, 2)
+	for i := 0; i < 20000; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		v := e.Assign(key)
+		if e.Assign(key) != v {
+			t.Fatalf("expected stable assignment of %s", key)
+		}
+		counts[v]++
+	}
+
+	if math.Abs(float64(counts[0])/20000-0.75) > 0.02 {
+		t.Errorf("expected about 75%% of a, got %v", counts)
+	}
+}
+
+func TestExperiment_Validate(t *testing.T) {
+	t.Parallel()
+
+	client := NewClient("key")
+
+	if _, err := client.SendVariants(context.Background(), Experiment{}, nil); !errors.Is(err, ErrNoVariants) {
+		t.Errorf("expected ErrNoVariants, got %v", err)
+	}
+
+	e := Experiment{Variants: []Variant{{Name: "a"}}}
+	if _, err := client.SendVariants(context.Background(), e, nil); !errors.Is(err, ErrInvalidVariantWeight) {
+		t.Errorf("expected ErrInvalidVariantWeight, got %v", err)
+	}
+
+	// The variants must have a notification or data when the message has none
+	var assigned int
+	e = Experiment{
+		Variants: []Variant{{Name: "a", Weight: 1, Data: map[string]string{"v": "a"}}, {Name: "b", Weight: 1}},
+		OnAssign: func(a VariantAssignment) { assigned++ },
+	}
+	if _, err := client.SendVariants(context.Background(), e, []VariantRecipient{{Token: "token"}}); !errors.Is(err, ErrDataIsEmpty) {
+		t.Errorf("expected ErrDataIsEmpty, got %v", err)
+	}
+
+	if assigned != 0 {
+		t.Errorf("expected no assignments, got %d", assigned)
+	}
+}
+
+func TestClient_SendVariants(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	titles := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var m message
+		json.NewDecoder(req.Body).Decode(&m)
+
+		resp := Response{Success: len(m.RegistrationIds)}
+		mu.Lock()
+		for _, token := range m.RegistrationIds {
+			titles[token] = m.Notification.Title
+			resp.Results = append(resp.Results, Result{MessageID: MessageID("id-" + token)})
+		}
+		mu.Unlock()
+
+		json.NewEncoder(rw).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient("key", WithEndpoints(Endpoints{FCM: server.URL}))
+	client.SetNotification(&NotificationPayload{Title: "Default", Body: "Body"})
+
+	var mu2 sync.Mutex
+	exposures := make(map[string]string)
+	e := Experiment{ID: "exp-1", Variants: []Variant{
+		{Name: "a", Weight: 1, Notification: &NotificationPayload{Title: "Title A", Body: "Body"}},
+		{Name: "b", Weight: 1},
+	}, OnAssign: func(a VariantAssignment) {
+		mu2.Lock()
+		defer mu2.Unlock()
+		exposures[a.Token] = a.Variant
+	}}
+
+	var recipients []VariantRecipient
+	for i := 0; i < 50; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		recipients = append(recipients,
+			VariantRecipient{Token: user + "-phone", Key: user},
+			VariantRecipient{Token: user + "-tablet", Key: user},
+		)
+	}
+
+	assignments, err := client.SendVariants(context.Background(), e, recipients)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{"a": "Title A", "b": "Default"}
+	for i, a := range assignments {
+		if a.Token != recipients[i].Token || a.MessageID != MessageID("id-"+a.Token) {
+			t.Errorf("unexpected assignment %+v", a)
+		}
+
+		if exposures[a.Token] != a.Variant {
+			t.Errorf("%s: expected exposure of %s, got %s", a.Token, a.Variant, exposures[a.Token])
+		}
+
+		if titles[a.Token] != expected[a.Variant] {
+			t.Errorf("%s: expected %s, got %s", a.Token, expected[a.Variant], titles[a.Token])
+		}
+
+		// All the tokens of a user get the same variant
+		if i%2 == 1 && assignments[i-1].Variant != a.Variant {
+			t.Errorf("expected same variant for %s", a.Key)
+		}
+	}
+
+	if client.Message.Notification.Title != "Default" || client.Message.RegistrationIds != nil {
+		t.Errorf("expected client message untouched, got %+v", client.Message)
+	}
+}
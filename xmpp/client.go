@@ -0,0 +1,365 @@
+// Package xmpp client of the FCM XMPP connection server, it sends downstream messages with
+// ack/nack handling and flow control, and receives upstream messages and delivery receipts.
+//
+//	client, err := xmpp.NewClient(xmpp.Config{
+//		SenderID:   "sender id",
+//		APIKey:     "key",
+//		OnUpstream: func(u xmpp.Upstream) { log.Println(u.From, u.Data) },
+//	})
+//	err = client.Send(ctx, &xmpp.Message{To: "token", Data: data})
+package xmpp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/douglasmakey/go-fcm"
+)
+
+const (
+	// Addresses of the connection server
+	DefaultAddr    = "fcm-xmpp.googleapis.com:5235"
+	PreProductAddr = "fcm-xmpp.googleapis.com:5236"
+
+	// Max messages pending of ack per connection permit by FCM
+	maxPending = 100
+
+	// Default timeout to dial and authenticate
+	defaultDialTimeout = 30 * time.Second
+
+	// Delays between the attempts to reconnect after a connection is lost
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
+
+var (
+	// Errors
+	ErrSenderIDIsEmpty = errors.New("xmpp: sender id is empty")
+	ErrAPIKeyIsEmpty   = errors.New("xmpp: api key is empty")
+	ErrUnauthorized    = errors.New("xmpp: authentication failed")
+	ErrClosed          = errors.New("xmpp: connection closed")
+)
+
+// Config of the client
+type Config struct {
+	SenderID string
+	APIKey   string
+	// Addr of the connection server, DefaultAddr if empty
+	Addr string
+	// TLSConfig used to dial Addr
+	TLSConfig *tls.Config
+	// Dial open the connection with the server, it replaces the TLS dial of Addr
+	Dial func(ctx context.Context) (net.Conn, error)
+	// MaxPending max messages pending of ack per connection, 100 if zero
+	MaxPending int
+
+	// OnUpstream is called with the messages sent by the devices, the message is
+	// acknowledged when it returns
+	OnUpstream func(Upstream)
+	// Receipts handle the delivery receipts, the receipt is acknowledged when it returns
+	Receipts fcm.ReceiptHandler
+	// OnError is called with the errors not returned by Send
+	OnError func(error)
+}
+
+// Client of the connection server, it keeps a connection open and opens a new one
+// when the server drains the current one or the connection is lost
+type Client struct {
+	cfg Config
+
+	mu     sync.Mutex
+	active *conn
+	conns  map[*conn]struct{}
+	// dialing is closed when the connection being opened is ready or failed
+	dialing chan struct{}
+	closed  bool
+	// closing is closed by Close to stop reconnecting
+	closing chan struct{}
+}
+
+// NewClient create a client, the connection is opened by Connect or the first Send
+func NewClient(cfg Config) (*Client, error) {
+	if cfg.SenderID == "" {
+		return nil, ErrSenderIDIsEmpty
+	}
+
+	if cfg.APIKey == "" {
+		return nil, ErrAPIKeyIsEmpty
+	}
+
+	if cfg.Addr == "" {
+		cfg.Addr = DefaultAddr
+	}
+
+	if cfg.MaxPending <= 0 || cfg.MaxPending > maxPending {
+		cfg.MaxPending = maxPending
+	}
+
+	return &Client{
+		cfg:     cfg,
+		conns:   make(map[*conn]struct{}),
+		closing: make(chan struct{}),
+	}, nil
+}
+
+// Connect open the connection with the server
+func (c *Client) Connect(ctx context.Context) error {
+	_, err := c.conn(ctx)
+	return err
+}
+
+// Send send the message and wait for its ack, a *NackError is returned if the server
+// reject the message. An id is generated if MessageID is empty
+func (c *Client) Send(ctx context.Context, m *Message) error {
+	if m.FcmOptions != nil {
+		if err := m.FcmOptions.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if m.MessageID == "" {
+		m.MessageID = newMessageID()
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	for {
+		cn, err := c.conn(ctx)
+		if err != nil {
+			return err
+		}
+
+		// Wait for a slot, the server permit a limited number of messages pending of ack
+		select {
+		case cn.slots <- struct{}{}:
+		case <-cn.done:
+			continue
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if cn.isDraining() {
+			<-cn.slots
+			continue
+		}
+
+		ch, err := cn.register(m.MessageID)
+		if err != nil {
+			<-cn.slots
+			continue
+		}
+
+		if err := cn.writeMessage(b); err != nil {
+			cn.close(err)
+			return err
+		}
+
+		select {
+		case err := <-ch:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Close close the connections with the server
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.closing)
+	}
+	conns := make([]*conn, 0, len(c.conns))
+	for cn := range c.conns {
+		conns = append(conns, cn)
+	}
+	c.mu.Unlock()
+
+	for _, cn := range conns {
+		cn.close(ErrClosed)
+	}
+
+	return nil
+}
+
+// conn return the active connection, opening a new one if needed. The lock is not held
+// while dialing, concurrent callers wait for the connection being opened
+func (c *Client) conn(ctx context.Context) (*conn, error) {
+	for {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return nil, ErrClosed
+		}
+
+		// A closed or draining connection can still be active until it is removed
+		if c.active != nil && !c.active.usable() {
+			c.active = nil
+		}
+
+		if c.active != nil {
+			cn := c.active
+			c.mu.Unlock()
+			return cn, nil
+		}
+
+		if dialing := c.dialing; dialing != nil {
+			c.mu.Unlock()
+			select {
+			case <-dialing:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		dialing := make(chan struct{})
+		c.dialing = dialing
+		c.mu.Unlock()
+
+		cn, err := c.dial(ctx)
+
+		c.mu.Lock()
+		c.dialing = nil
+		close(dialing)
+		if err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+
+		if c.closed {
+			c.mu.Unlock()
+			cn.close(ErrClosed)
+			return nil, ErrClosed
+		}
+
+		c.active = cn
+		c.conns[cn] = struct{}{}
+		c.mu.Unlock()
+
+		go cn.readLoop()
+
+		return cn, nil
+	}
+}
+
+// dial open and authenticate a connection
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultDialTimeout)
+		defer cancel()
+	}
+
+	var nc net.Conn
+	var err error
+	if c.cfg.Dial != nil {
+		nc, err = c.cfg.Dial(ctx)
+	} else {
+		d := &tls.Dialer{Config: c.cfg.TLSConfig}
+		nc, err = d.DialContext(ctx, "tcp", c.cfg.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		nc.SetDeadline(deadline)
+	}
+
+	cn := newConn(c, nc)
+	if err := cn.handshake(c.cfg.SenderID, c.cfg.APIKey); err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	nc.SetDeadline(time.Time{})
+
+	return cn, nil
+}
+
+// drain stop using cn for new messages and open a new connection
+func (c *Client) drain(cn *conn) {
+	c.mu.Lock()
+	if c.active == cn {
+		c.active = nil
+	}
+	c.mu.Unlock()
+
+	go c.reconnect()
+}
+
+// reconnect open a new connection, retrying with a growing delay until it succeeds,
+// the client is closed or the server reject the credentials
+func (c *Client) reconnect() {
+	delay := minReconnectDelay
+	for {
+		_, err := c.conn(context.Background())
+		if err == nil || err == ErrClosed {
+			return
+		}
+
+		c.handleError(err)
+		if err == ErrUnauthorized {
+			return
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-c.closing:
+			return
+		}
+
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// remove the closed connection cn
+func (c *Client) remove(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.conns, cn)
+	if c.active == cn {
+		c.active = nil
+	}
+}
+
+func (c *Client) handleUpstream(u Upstream) {
+	if c.cfg.OnUpstream != nil {
+		c.cfg.OnUpstream(u)
+	}
+}
+
+func (c *Client) handleReceipt(r fcm.Receipt) {
+	if c.cfg.Receipts != nil {
+		c.cfg.Receipts.HandleReceipt(r)
+	}
+}
+
+func (c *Client) handleError(err error) {
+	if c.cfg.OnError != nil {
+		c.cfg.OnError(err)
+	}
+}
+
+// newMessageID return a random message id
+func newMessageID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,498 @@
+package xmpp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/douglasmakey/go-fcm"
+)
+
+// fakeServer local connection server
+type fakeServer struct {
+	t  *testing.T
+	ln net.Listener
+
+	// manual disable the automatic ack of downstream messages
+	manual bool
+
+	mu    sync.Mutex
+	conns []*fakeConn
+
+	// downstream messages received
+	downstream chan fakeMessage
+	// acks of upstream messages and receipts
+	acks chan inbound
+}
+
+type fakeMessage struct {
+	conn    *fakeConn
+	message map[string]interface{}
+}
+
+type fakeConn struct {
+	nc  net.Conn
+	wmu sync.Mutex
+}
+
+func (fc *fakeConn) write(s string) {
+	fc.wmu.Lock()
+	defer fc.wmu.Unlock()
+	io.WriteString(fc.nc, s)
+}
+
+// send a JSON payload to the client
+func (fc *fakeConn) send(v interface{}) {
+	b, _ := json.Marshal(v)
+	fc.wmu.Lock()
+	defer fc.wmu.Unlock()
+	io.WriteString(fc.nc, `<message><data:gcm xmlns:data="google:mobile:data">`)
+	xml.EscapeText(fc.nc, b)
+	io.WriteString(fc.nc, `</data:gcm></message>`)
+}
+
+func newFakeServer(t *testing.T, manual bool) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s := &fakeServer{
+		t:          t,
+		ln:         ln,
+		manual:     manual,
+		downstream: make(chan fakeMessage, 100),
+		acks:       make(chan inbound, 100),
+	}
+
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(nc)
+		}
+	}()
+
+	return s
+}
+
+func (s *fakeServer) close() {
+	s.ln.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, fc := range s.conns {
+		fc.nc.Close()
+	}
+}
+
+func (s *fakeServer) conn(i int) *fakeConn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns[i]
+}
+
+// waitConns wait until the server has n connections
+func (s *fakeServer) waitConns(n int) {
+	for i := 0; i < 100; i++ {
+		s.mu.Lock()
+		l := len(s.conns)
+		s.mu.Unlock()
+		if l >= n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.t.Fatalf("expected %d connections", n)
+}
+
+func (s *fakeServer) config() Config {
+	return Config{
+		SenderID: "123",
+		APIKey:   "key",
+		Dial: func(ctx context.Context) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "tcp", s.ln.Addr().String())
+		},
+	}
+}
+
+func (s *fakeServer) serve(nc net.Conn) {
+	fc := &fakeConn{nc: nc}
+	dec := xml.NewDecoder(nc)
+	header := `<stream:stream from="fcm.googleapis.com" id="1" version="1.0" xmlns="jabber:client" xmlns:stream="http://etherx.jabber.org/streams">`
+
+	next := func() (xml.StartElement, error) {
+		for {
+			t, err := dec.Token()
+			if err != nil {
+				return xml.StartElement{}, err
+			}
+			if se, ok := t.(xml.StartElement); ok {
+				return se, nil
+			}
+		}
+	}
+
+	// Authentication
+	if _, err := next(); err != nil {
+		return
+	}
+	fc.write(header + `<stream:features><mechanisms xmlns="urn:ietf:params:xml:ns:xmpp-sasl"><mechanism>X-OAUTH2</mechanism><mechanism>PLAIN</mechanism></mechanisms></stream:features>`)
+
+	se, err := next()
+	if err != nil {
+		return
+	}
+	var auth string
+	dec.DecodeElement(&auth, &se)
+	creds, _ := base64.StdEncoding.DecodeString(auth)
+	if string(creds) != "\x00123@fcm.googleapis.com\x00key" {
+		fc.write(`<failure xmlns="urn:ietf:params:xml:ns:xmpp-sasl"><not-authorized/></failure></stream:stream>`)
+		nc.Close()
+		return
+	}
+	fc.write(`<success xmlns="urn:ietf:params:xml:ns:xmpp-sasl"/>`)
+
+	// Binding
+	if _, err := next(); err != nil {
+		return
+	}
+	fc.write(header + `<stream:features><bind xmlns="urn:ietf:params:xml:ns:xmpp-bind"/><session xmlns="urn:ietf:params:xml:ns:xmpp-session"/></stream:features>`)
+	if se, err = next(); err != nil {
+		return
+	}
+	dec.Skip()
+	fc.write(`<iq type="result" id="bind"><bind xmlns="urn:ietf:params:xml:ns:xmpp-bind"><jid>123@fcm.googleapis.com/r</jid></bind></iq>`)
+
+	s.mu.Lock()
+	s.conns = append(s.conns, fc)
+	s.mu.Unlock()
+
+	for {
+		se, err := next()
+		if err != nil {
+			return
+		}
+
+		var st stanza
+		if err := dec.DecodeElement(&st, &se); err != nil {
+			return
+		}
+
+		var in inbound
+		json.Unmarshal([]byte(st.GCM), &in)
+		if in.MessageType == typeAck {
+			s.acks <- in
+			continue
+		}
+
+		var m map[string]interface{}
+		json.Unmarshal([]byte(st.GCM), &m)
+		s.downstream <- fakeMessage{conn: fc, message: m}
+
+		if !s.manual {
+			s.reply(fc, m)
+		}
+	}
+}
+
+// reply ack or nack the downstream message m, messages to "bad" are nacked
+func (s *fakeServer) reply(fc *fakeConn, m map[string]interface{}) {
+	if m["to"] == "bad" {
+		fc.send(map[string]string{
+			"message_type":      typeNack,
+			"message_id":        m["message_id"].(string),
+			"from":              "bad",
+			"error":             "BAD_REGISTRATION",
+			"error_description": "Invalid token",
+		})
+		return
+	}
+
+	fc.send(map[string]string{
+		"message_type": typeAck,
+		"message_id":   m["message_id"].(string),
+		"from":         m["to"].(string),
+	})
+}
+
+func TestClient_Send(t *testing.T) {
+	t.Parallel()
+
+	server := newFakeServer(t, false)
+	defer server.close()
+
+	client, err := NewClient(server.config())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	m := &Message{To: "token", Data: map[string]string{"body": "Test"}}
+	if err := client.Send(ctx, m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if m.MessageID == "" {
+		t.Error("expected generated message id")
+	}
+
+	received := <-server.downstream
+	if received.message["message_id"] != m.MessageID {
+		t.Errorf("expected %s, got %v", m.MessageID, received.message["message_id"])
+	}
+
+	err = client.Send(ctx, &Message{To: "bad", Data: map[string]string{"body": "Test"}})
+	var nack *NackError
+	if !errors.As(err, &nack) || nack.Code != "BAD_REGISTRATION" {
+		t.Errorf("expected BAD_REGISTRATION nack, got %v", err)
+	}
+
+	err = client.Send(ctx, &Message{To: "token", FcmOptions: &fcm.FcmOptions{AnalyticsLabel: "bad label"}})
+	if err != fcm.ErrInvalidAnalyticsLabel {
+		t.Errorf("expected ErrInvalidAnalyticsLabel, got %v", err)
+	}
+}
+
+func TestClient_Unauthorized(t *testing.T) {
+	t.Parallel()
+
+	server := newFakeServer(t, false)
+	defer server.close()
+
+	cfg := server.config()
+	cfg.APIKey = "wrong"
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := client.Connect(context.Background()); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestClient_UpstreamAndReceipts(t *testing.T) {
+	t.Parallel()
+
+	server := newFakeServer(t, false)
+	defer server.close()
+
+	upstream := make(chan Upstream, 1)
+	receipts := make(chan fcm.Receipt, 1)
+	cfg := server.config()
+	cfg.OnUpstream = func(u Upstream) { upstream <- u }
+	cfg.Receipts = fcm.ReceiptHandlerFunc(func(r fcm.Receipt) { receipts <- r })
+
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fc := server.conn(0)
+	fc.send(map[string]interface{}{
+		"category":   "com.example",
+		"message_id": "up-1",
+		"from":       "device",
+		"data":       map[string]string{"hello": "world"},
+	})
+
+	u := <-upstream
+	if u.From != "device" || u.Data["hello"] != "world" {
+		t.Errorf("unexpected upstream %+v", u)
+	}
+
+	if a := <-server.acks; a.MessageID != "up-1" {
+		t.Errorf("expected ack of up-1, got %s", a.MessageID)
+	}
+
+	fc.send(map[string]interface{}{
+		"message_type": typeReceipt,
+		"message_id":   "dr2:m-1",
+		"from":         "gcm.googleapis.com",
+		"data": map[string]string{
+			"message_status":         "MESSAGE_SENT_TO_DEVICE",
+			"original_message_id":    "m-1",
+			"device_registration_id": "device",
+			"message_sent_timestamp": "1486995556000",
+		},
+	})
+
+	r := <-receipts
+	if r.OriginalMessageID != "m-1" || !r.Delivered() {
+		t.Errorf("unexpected receipt %+v", r)
+	}
+
+	if r.SentAt.Unix() != 1486995556 {
+		t.Errorf("expected 1486995556, got %d", r.SentAt.Unix())
+	}
+
+	if a := <-server.acks; a.MessageID != "dr2:m-1" {
+		t.Errorf("expected ack of dr2:m-1, got %s", a.MessageID)
+	}
+}
+
+func TestClient_FlowControl(t *testing.T) {
+	t.Parallel()
+
+	server := newFakeServer(t, true)
+	defer server.close()
+
+	cfg := server.config()
+	cfg.MaxPending = 2
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer client.Close()
+
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			errs <- client.Send(context.Background(), &Message{To: "token", MessageID: fmt.Sprintf("m-%d", i)})
+		}(i)
+	}
+
+	first := <-server.downstream
+	second := <-server.downstream
+
+	select {
+	case m := <-server.downstream:
+		t.Fatalf("expected at most 2 pending messages, got %v", m.message["message_id"])
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	server.reply(first.conn, first.message)
+	if err := <-errs; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	third := <-server.downstream
+	server.reply(second.conn, second.message)
+	server.reply(third.conn, third.message)
+
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestClient_ConnectionDraining(t *testing.T) {
+	t.Parallel()
+
+	server := newFakeServer(t, true)
+	defer server.close()
+
+	client, err := NewClient(server.config())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer client.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- client.Send(context.Background(), &Message{To: "token", MessageID: "m-1"})
+	}()
+
+	first := <-server.downstream
+	first.conn.send(map[string]string{"message_type": typeControl, "control_type": controlDraining})
+
+	// A new connection is opened when the server drains the current one
+	server.waitConns(2)
+
+	go func() {
+		errs <- client.Send(context.Background(), &Message{To: "token", MessageID: "m-2"})
+	}()
+
+	second := <-server.downstream
+	if second.conn == first.conn {
+		t.Fatal("expected message sent through a new connection")
+	}
+
+	// The draining connection still receives the acks
+	server.reply(first.conn, first.message)
+	server.reply(second.conn, second.message)
+
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestClient_Reconnect(t *testing.T) {
+	t.Parallel()
+
+	server := newFakeServer(t, false)
+	defer server.close()
+
+	client, err := NewClient(server.config())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A new connection is opened when the current one is lost
+	server.conn(0).nc.Close()
+	server.waitConns(2)
+
+	if err := client.Send(context.Background(), &Message{To: "token", MessageID: "m-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if m := <-server.downstream; m.conn != server.conn(1) {
+		t.Error("expected message sent through the new connection")
+	}
+}
+
+func TestClient_ConcurrentConnect(t *testing.T) {
+	t.Parallel()
+
+	server := newFakeServer(t, false)
+	defer server.close()
+
+	client, err := NewClient(server.config())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := client.Connect(context.Background()); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.conns) != 1 {
+		t.Errorf("expected 1 connection, got %d", len(server.conns))
+	}
+}
@@ -0,0 +1,366 @@
+package xmpp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/douglasmakey/go-fcm"
+)
+
+const (
+	// Namespaces
+	nsStream = "http://etherx.jabber.org/streams"
+	nsSASL   = "urn:ietf:params:xml:ns:xmpp-sasl"
+	nsBind   = "urn:ietf:params:xml:ns:xmpp-bind"
+	nsGCM    = "google:mobile:data"
+
+	// Domain of the connection server
+	domain = "fcm.googleapis.com"
+)
+
+type saslMechanisms struct {
+	Mechanism []string `xml:"mechanism"`
+}
+
+type features struct {
+	Mechanisms *saslMechanisms `xml:"urn:ietf:params:xml:ns:xmpp-sasl mechanisms"`
+	Bind       *struct{}       `xml:"urn:ietf:params:xml:ns:xmpp-bind bind"`
+}
+
+type bindResult struct {
+	Type string `xml:"type,attr"`
+	JID  string `xml:"urn:ietf:params:xml:ns:xmpp-bind bind>jid"`
+}
+
+type stanza struct {
+	Type string `xml:"type,attr"`
+	GCM  string `xml:"google:mobile:data gcm"`
+}
+
+// conn connection with the connection server
+type conn struct {
+	client *Client
+	nc     net.Conn
+	dec    *xml.Decoder
+
+	// wmu serialize the writes
+	wmu sync.Mutex
+
+	// slots limit the messages pending of ack
+	slots chan struct{}
+
+	mu       sync.Mutex
+	pending  map[string]chan error
+	draining bool
+	err      error
+	done     chan struct{}
+}
+
+func newConn(client *Client, nc net.Conn) *conn {
+	return &conn{
+		client:  client,
+		nc:      nc,
+		dec:     xml.NewDecoder(nc),
+		slots:   make(chan struct{}, client.cfg.MaxPending),
+		pending: make(map[string]chan error),
+		done:    make(chan struct{}),
+	}
+}
+
+// handshake open the stream, authenticate with the sender id and key and bind the resource
+func (cn *conn) handshake(senderID, key string) error {
+	f, err := cn.openStream()
+	if err != nil {
+		return err
+	}
+
+	if f.Mechanisms == nil || !contains(f.Mechanisms.Mechanism, "PLAIN") {
+		return errors.New("xmpp: PLAIN authentication not supported")
+	}
+
+	auth := base64.StdEncoding.EncodeToString([]byte("\x00" + senderID + "@" + domain + "\x00" + key))
+	if err := cn.writeRaw(fmt.Sprintf(`<auth mechanism="PLAIN" xmlns="%s">%s</auth>`, nsSASL, auth)); err != nil {
+		return err
+	}
+
+	se, err := cn.nextElement()
+	if err != nil {
+		return err
+	}
+	if err := cn.dec.Skip(); err != nil {
+		return err
+	}
+	if se.Name.Local != "success" {
+		return ErrUnauthorized
+	}
+
+	// Restart the stream after authentication
+	if f, err = cn.openStream(); err != nil {
+		return err
+	}
+	if f.Bind == nil {
+		return errors.New("xmpp: resource binding not supported")
+	}
+
+	if err := cn.writeRaw(fmt.Sprintf(`<iq type="set" id="bind"><bind xmlns="%s"/></iq>`, nsBind)); err != nil {
+		return err
+	}
+
+	se, err = cn.nextElement()
+	if err != nil {
+		return err
+	}
+	var br bindResult
+	if err := cn.dec.DecodeElement(&br, &se); err != nil {
+		return err
+	}
+	if se.Name.Local != "iq" || br.Type != "result" {
+		return errors.New("xmpp: resource binding failed")
+	}
+
+	return nil
+}
+
+// openStream open the stream and read the features of the server
+func (cn *conn) openStream() (*features, error) {
+	header := fmt.Sprintf(`<stream:stream to="%s" version="1.0" xmlns="jabber:client" xmlns:stream="%s">`, domain, nsStream)
+	if err := cn.writeRaw(header); err != nil {
+		return nil, err
+	}
+
+	se, err := cn.nextElement()
+	if err != nil {
+		return nil, err
+	}
+	if se.Name.Space != nsStream || se.Name.Local != "stream" {
+		return nil, fmt.Errorf("xmpp: unexpected element %s", se.Name.Local)
+	}
+
+	se, err = cn.nextElement()
+	if err != nil {
+		return nil, err
+	}
+	if se.Name.Space != nsStream || se.Name.Local != "features" {
+		return nil, fmt.Errorf("xmpp: unexpected element %s", se.Name.Local)
+	}
+
+	f := new(features)
+	if err := cn.dec.DecodeElement(f, &se); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// nextElement return the next start element, io.EOF if the stream is closed
+func (cn *conn) nextElement() (xml.StartElement, error) {
+	for {
+		t, err := cn.dec.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			return t, nil
+		case xml.EndElement:
+			if t.Name.Space == nsStream && t.Name.Local == "stream" {
+				return xml.StartElement{}, io.EOF
+			}
+		}
+	}
+}
+
+// readLoop read the stanzas until the connection is closed, a new connection is
+// opened if it was lost without closing the client
+func (cn *conn) readLoop() {
+	var err error
+	defer func() {
+		cn.close(err)
+		cn.client.reconnect()
+	}()
+
+	for {
+		var se xml.StartElement
+		if se, err = cn.nextElement(); err != nil {
+			return
+		}
+
+		if se.Name.Local != "message" {
+			if err = cn.dec.Skip(); err != nil {
+				return
+			}
+			continue
+		}
+
+		var s stanza
+		if err = cn.dec.DecodeElement(&s, &se); err != nil {
+			return
+		}
+		if s.GCM == "" {
+			continue
+		}
+
+		var in inbound
+		if err := json.Unmarshal([]byte(s.GCM), &in); err != nil {
+			cn.client.handleError(fmt.Errorf("xmpp: invalid message: %v", err))
+			continue
+		}
+
+		cn.handle(&in)
+	}
+}
+
+// handle process a message received from the connection server
+func (cn *conn) handle(in *inbound) {
+	switch in.MessageType {
+	case typeAck:
+		cn.resolve(in.MessageID, nil)
+	case typeNack:
+		cn.resolve(in.MessageID, &NackError{
+			MessageID:   in.MessageID,
+			Code:        in.Error,
+			Description: in.ErrorDescription,
+		})
+	case typeControl:
+		if in.ControlType == controlDraining {
+			cn.mu.Lock()
+			cn.draining = true
+			cn.mu.Unlock()
+			cn.client.drain(cn)
+		}
+	case typeReceipt:
+		cn.client.handleReceipt(fcm.NewReceipt(in.MessageID, in.Category, in.Data))
+		cn.ack(in)
+	case "":
+		cn.client.handleUpstream(Upstream{
+			From:      in.From,
+			Category:  in.Category,
+			MessageID: in.MessageID,
+			Data:      in.Data,
+		})
+		cn.ack(in)
+	}
+}
+
+// ack acknowledge a message received from the connection server
+func (cn *conn) ack(in *inbound) {
+	b, err := json.Marshal(ack{To: in.From, MessageID: in.MessageID, MessageType: typeAck})
+	if err == nil {
+		err = cn.writeMessage(b)
+	}
+	if err != nil {
+		cn.client.handleError(fmt.Errorf("xmpp: ack %s: %v", in.MessageID, err))
+	}
+}
+
+// register a message pending of ack
+func (cn *conn) register(id string) (chan error, error) {
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+
+	if cn.err != nil {
+		return nil, cn.err
+	}
+
+	ch := make(chan error, 1)
+	cn.pending[id] = ch
+
+	return ch, nil
+}
+
+// resolve the message pending of ack and release its slot
+func (cn *conn) resolve(id string, err error) {
+	cn.mu.Lock()
+	ch, ok := cn.pending[id]
+	delete(cn.pending, id)
+	cn.mu.Unlock()
+
+	if ok {
+		ch <- err
+		<-cn.slots
+	}
+}
+
+// isDraining return true if the server asked to stop sending messages through the connection
+func (cn *conn) isDraining() bool {
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+
+	return cn.draining
+}
+
+// usable return true if new messages can be sent through the connection
+func (cn *conn) usable() bool {
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+
+	return cn.err == nil && !cn.draining
+}
+
+// writeMessage write the JSON payload b inside a message stanza
+func (cn *conn) writeMessage(b []byte) error {
+	cn.wmu.Lock()
+	defer cn.wmu.Unlock()
+
+	if _, err := io.WriteString(cn.nc, `<message id=""><gcm xmlns="`+nsGCM+`">`); err != nil {
+		return err
+	}
+	if err := xml.EscapeText(cn.nc, b); err != nil {
+		return err
+	}
+	_, err := io.WriteString(cn.nc, `</gcm></message>`)
+
+	return err
+}
+
+func (cn *conn) writeRaw(s string) error {
+	cn.wmu.Lock()
+	defer cn.wmu.Unlock()
+
+	_, err := io.WriteString(cn.nc, s)
+
+	return err
+}
+
+// close the connection and fail the messages pending of ack
+func (cn *conn) close(err error) {
+	cn.mu.Lock()
+	if cn.err != nil {
+		cn.mu.Unlock()
+		return
+	}
+	if err == nil || err == io.EOF {
+		err = ErrClosed
+	}
+	cn.err = err
+	pending := cn.pending
+	cn.pending = make(map[string]chan error)
+	cn.mu.Unlock()
+
+	cn.writeRaw("</stream:stream>")
+	cn.nc.Close()
+	close(cn.done)
+
+	for _, ch := range pending {
+		ch <- err
+	}
+
+	cn.client.remove(cn)
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
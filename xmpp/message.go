@@ -0,0 +1,84 @@
+package xmpp
+
+import (
+	"fmt"
+
+	"github.com/douglasmakey/go-fcm"
+)
+
+const (
+	// Types of messages of the connection server
+	typeAck     = "ack"
+	typeNack    = "nack"
+	typeReceipt = "receipt"
+	typeControl = "control"
+
+	// Control types
+	controlDraining = "CONNECTION_DRAINING"
+)
+
+// Message downstream message sent through the connection server
+type Message struct {
+	To               string                   `json:"to,omitempty"`
+	Condition        string                   `json:"condition,omitempty"`
+	MessageID        string                   `json:"message_id"`
+	Data             interface{}              `json:"data,omitempty"`
+	Notification     *fcm.NotificationPayload `json:"notification,omitempty"`
+	Priority         string                   `json:"priority,omitempty"`
+	CollapseKey      string                   `json:"collapse_key,omitempty"`
+	ContentAvailable bool                     `json:"content_available,omitempty"`
+	MutableContent   bool                     `json:"mutable_content,omitempty"`
+	TimeToLive       *int                     `json:"time_to_live,omitempty"`
+	DryRun           bool                     `json:"dry_run,omitempty"`
+	FcmOptions       *fcm.FcmOptions          `json:"fcm_options,omitempty"`
+	// DeliveryReceiptRequested request a delivery receipt, it is passed to Config.Receipts
+	DeliveryReceiptRequested bool `json:"delivery_receipt_requested,omitempty"`
+}
+
+// Upstream message sent by a device to the server
+type Upstream struct {
+	From      string
+	Category  string
+	MessageID string
+	Data      map[string]string
+}
+
+// NackError error returned by the connection server when reject a message
+type NackError struct {
+	MessageID   string
+	Code        string
+	Description string
+}
+
+func (e *NackError) Error() string {
+	return fmt.Sprintf("nack %s: %s %s", e.MessageID, e.Code, e.Description)
+}
+
+// Temporary return true if the message can be sent again later
+func (e *NackError) Temporary() bool {
+	switch e.Code {
+	case "SERVICE_UNAVAILABLE", "INTERNAL_SERVER_ERROR", "CONNECTION_DRAINING", "DEVICE_MESSAGE_RATE_EXCEEDED", "TOPICS_MESSAGE_RATE_EXCEEDED":
+		return true
+	}
+
+	return false
+}
+
+// inbound JSON payload of a message received from the connection server
+type inbound struct {
+	MessageType      string            `json:"message_type"`
+	MessageID        string            `json:"message_id"`
+	From             string            `json:"from"`
+	Category         string            `json:"category"`
+	Error            string            `json:"error"`
+	ErrorDescription string            `json:"error_description"`
+	ControlType      string            `json:"control_type"`
+	Data             map[string]string `json:"data"`
+}
+
+// ack payload sent to acknowledge upstream messages and receipts
+type ack struct {
+	To          string `json:"to"`
+	MessageID   string `json:"message_id"`
+	MessageType string `json:"message_type"`
+}